@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/btm6084/gojson"
@@ -19,8 +20,15 @@ var spaces = regexp.MustCompile(`\s\s+`)
 // AsyncMockDB implements the Database interface and allows for database mocking.
 // AsyncMockDB checks THAT a query executes, but does not say that it happens in any order.
 // If you need to assert that your queries happen in order, use MockDB
+// Each call consumes the first Expected entry matching its query and args. Entries are used once
+// unless marked with Times or AnyTimes, and are removed from Expected when used up.
+// AsyncMockDB is safe for concurrent use, so it can match queries made from many goroutines at once.
 type AsyncMockDB struct {
-	t *testing.T
+	t  *testing.T
+	mu sync.Mutex
+
+	MockTxState
+	MockHealthState
 
 	FetchPointer int
 	FetchCount   int
@@ -33,32 +41,151 @@ type AsyncMockDB struct {
 
 	CallCount int
 	Expected  []DBResult
+
+	// ids holds the last auto increment ID of each table, when enabled by AutoIncrementIDs.
+	ids map[string]int64
 }
 
 // NewAsyncMockDB returns a ready to use AsyncMockDB struct.
-func NewAsyncMockDB(t *testing.T) *AsyncMockDB {
-	return &AsyncMockDB{t: t}
+func NewAsyncMockDB(t *testing.T, opts ...MockOption) *AsyncMockDB {
+	db := &AsyncMockDB{t: t}
+
+	cfg := newMockConfig(opts)
+	if cfg.verify && t != nil {
+		t.Cleanup(func() { db.AssertExpectations() })
+	}
+
+	if cfg.autoIncrement {
+		db.ids = map[string]int64{}
+	}
+
+	return db
+}
+
+// ExpectationsWereMet returns an error listing every Expected query that was not called as many times as expected,
+// and any transaction that was neither committed nor rolled back.
+func (db *AsyncMockDB) ExpectationsWereMet() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var unmet []string
+	for _, e := range db.Expected {
+		switch {
+		case e.times < 0:
+		case e.times > 1:
+			unmet = append(unmet, fmt.Sprintf("Query: %s %v (%d more times)", transformQuery(e.Query), e.Args, e.times))
+		default:
+			unmet = appendUnmet(unmet, "Query", []DBResult{e})
+		}
+	}
+
+	unmet = db.MockTxState.appendUnmet(unmet)
+
+	return unmetError(unmet)
+}
+
+// AssertExpectations fails the test if any Expected query was never called.
+func (db *AsyncMockDB) AssertExpectations() bool {
+	return assert.NoError(db.t, db.ExpectationsWereMet())
+}
+
+// consume returns the Expected entry satisfied by q and args, removing it once it has been used up.
+// An entry whose query, args and transaction all match is preferred over one whose query alone matches,
+// so the same query may be expected several times with different args.
+// Mismatches fail the test and return ErrMockMismatch.
+// consume must be called with db.mu held.
+func (db *AsyncMockDB) consume(op, q string, args []interface{}, inTx bool) (DBResult, error) {
+	k := -1
+	for i, e := range db.Expected {
+		if !e.queryMatches(q, QueryNormalized) {
+			continue
+		}
+
+		if e.argsMatch(args) && e.txMatches(inTx) {
+			k = i
+			break
+		}
+
+		if k < 0 {
+			k = i
+		}
+	}
+
+	if !assert.True(db.t, k >= 0, "Unexpected %s: %s", op, q) {
+		return DBResult{}, ErrMockMismatch
+	}
+
+	r := db.Expected[k]
+	if !assertArgs(db.t, r, args) || !assertTx(db.t, r, q, inTx) {
+		return DBResult{}, ErrMockMismatch
+	}
+
+	switch {
+	case r.times < 0:
+	case r.times > 1:
+		db.Expected[k].times--
+	default:
+		// Copy rather than shift in place, as the caller may still hold the original slice.
+		db.Expected = append(append([]DBResult(nil), db.Expected[:k]...), db.Expected[k+1:]...)
+	}
+
+	return r, nil
+}
+
+// Times marks the expectation to be used n times by an AsyncMockDB before it is removed.
+// n must be at least 1; use AnyTimes for an expectation that may not be used at all.
+// MockDB ignores Times, using each of its expectations once, in order.
+func (r DBResult) Times(n int) DBResult {
+	if n < 1 {
+		panic(fmt.Sprintf("godb.DBResult.Times: n must be at least 1, got %d", n))
+	}
+
+	r.times = n
+	return r
+}
+
+// Once marks the expectation to be used once by an AsyncMockDB. This is the default. MockDB ignores Once.
+func (r DBResult) Once() DBResult {
+	return r.Times(1)
+}
+
+// AnyTimes marks the expectation to be used any number of times by an AsyncMockDB, including none. MockDB ignores AnyTimes.
+func (r DBResult) AnyTimes() DBResult {
+	r.times = -1
+	return r
 }
 
 // AssertNoCalls asserts that there were no Fetch or Exec calls.
 func (db *AsyncMockDB) AssertNoCalls() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	assert.Zero(db.t, db.FetchCount, "No Fetches Expected")
 	assert.Zero(db.t, db.ExecCount, "No Execs Expected")
 }
 
-// Ping satisfies the Database interface.
-func (db *AsyncMockDB) Ping(ctx context.Context) error {
-	return nil
+// Ping returns the configured PingError, see MockHealthState.
+func (db *AsyncMockDB) Ping(context.Context) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.ping()
 }
 
-// Shutdown satisfies the Database interface.
-func (db *AsyncMockDB) Shutdown(ctx context.Context) error {
-	return nil
+// Shutdown returns the configured ShutdownError.
+func (db *AsyncMockDB) Shutdown(context.Context) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.shutdown()
 }
 
-// Stats satisfies the Database interface.
+// Stats returns the configured DBStats.
 func (db *AsyncMockDB) Stats(context.Context) sql.DBStats {
-	return sql.DBStats{}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.stats()
 }
 
 // FetchWithMetrics mocks FetchWithMetrics by simply ignoring the metrics during the unittest.
@@ -69,41 +196,26 @@ func (db *AsyncMockDB) FetchWithMetrics(ctx context.Context, r metrics.Recorder,
 
 // Fetch allows for mocking the response from a fetch request.
 func (db *AsyncMockDB) Fetch(ctx context.Context, q string, c interface{}, args ...interface{}) error {
-	db.CallCount++
-	db.FetchCount++
-
-	if !assert.True(db.t, len(db.Expected) > 0, "No Expected Results Defined") {
-		db.t.FailNow()
-	}
-
-	// We repeat the final registered Fetch mock if we run out.
-	if db.FetchCount > len(db.Expected) {
-		fmt.Print("\nMore Fetch Calls than Expected\n\n")
-		db.t.FailNow()
-	}
+	return db.fetch(q, c, args, false)
+}
 
-	q = transformQuery(q)
+func (db *AsyncMockDB) fetch(q string, c interface{}, args []interface{}, inTx bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	var fetch DBResult
-	for k := range db.Expected {
-		db.Expected[k].Query = transformQuery(db.Expected[k].Query)
-		if db.Expected[k].Query == q {
-			fetch = db.Expected[k]
-			break
-		}
-	}
+	db.CallCount++
+	db.FetchCount++
 
-	if !assert.Equal(db.t, fetch.Query, q) {
-		db.t.FailNow()
+	fetch, err := db.consume("Fetch", q, args, inTx)
+	if err != nil {
+		return err
 	}
 
-	assertDeepEqual(db.t, fetch.Args, args)
-
 	if fetch.Error != nil {
 		return fetch.Error
 	}
 
-	err := gojson.Unmarshal(fetch.Content, c)
+	err = gojson.Unmarshal(fetch.Content, c)
 	assert.Nil(db.t, err)
 
 	return nil
@@ -125,41 +237,29 @@ func (db *AsyncMockDB) ExecWithMetrics(ctx context.Context, r metrics.Recorder,
 
 // Exec allows for mocking the response from an exec request.
 func (db *AsyncMockDB) Exec(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
-	db.CallCount++
-	db.ExecCount++
-
-	if !assert.True(db.t, len(db.Expected) > 0, "No Expected Defined") {
-		db.t.FailNow()
-	}
-
-	// We repeat the final registered Exec mock if we run out.
-	if db.ExecCount > len(db.Expected) {
-		fmt.Print("\nMore Exec Calls than Expected\n\n")
-		db.t.FailNow()
-	}
+	return db.exec(q, args, false)
+}
 
-	q = transformQuery(q)
+func (db *AsyncMockDB) exec(q string, args []interface{}, inTx bool) (sql.Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	var exec DBResult
-	for k := range db.Expected {
-		db.Expected[k].Query = transformQuery(db.Expected[k].Query)
-		if db.Expected[k].Query == q {
-			exec = db.Expected[k]
-			break
-		}
-	}
+	db.CallCount++
+	db.ExecCount++
 
-	if exec.Query == "" || !assert.Equal(db.t, exec.Query, q) {
-		db.t.FailNow()
+	exec, err := db.consume("Exec", q, args, inTx)
+	if err != nil {
+		return nil, err
 	}
 
-	assertDeepEqual(db.t, exec.Args, args)
-
 	if exec.Error != nil {
 		return nil, exec.Error
 	}
 
-	return &exec.Result, nil
+	res := exec.Result
+	assignInsertID(db.ids, q, &res)
+
+	return &res, nil
 }
 
 // FetchJSONWithMetrics mocks FetchJSONWithMetrics by simply ignoring the metrics during the unittest.
@@ -170,28 +270,21 @@ func (db *AsyncMockDB) FetchJSONWithMetrics(ctx context.Context, r metrics.Recor
 
 // FetchJSON allows for mocking the response from a fetch request.
 func (db *AsyncMockDB) FetchJSON(ctx context.Context, q string, args ...interface{}) ([]byte, error) {
-	db.CallCount++
-	db.FetchJSONCount++
-
-	if !assert.True(db.t, len(db.Expected) > 0, "No Expected Defined") {
-		db.t.FailNow()
-	}
+	return db.fetchJSON(q, args, false)
+}
 
-	// We repeat the final registered FetchJSON mock if we run out.
-	if db.FetchJSONPointer >= len(db.Expected) {
-		fmt.Print("\nMore FetchJSON Calls than Expected\n\n")
-		db.t.FailNow()
-	}
+func (db *AsyncMockDB) fetchJSON(q string, args []interface{}, inTx bool) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	fetch := db.Expected[db.FetchJSONPointer]
-	db.FetchJSONPointer++
+	db.CallCount++
+	db.FetchJSONCount++
 
-	if !assert.Equal(db.t, fetch.Query, q) {
-		db.t.FailNow()
+	fetch, err := db.consume("FetchJSON", q, args, inTx)
+	if err != nil {
+		return nil, err
 	}
 
-	assertDeepEqual(db.t, fetch.Args, args)
-
 	if fetch.Error != nil {
 		return nil, fetch.Error
 	}
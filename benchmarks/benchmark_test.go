@@ -3,6 +3,8 @@ package benchmarks
 import (
 	"bytes"
 	"testing"
+
+	"github.com/btm6084/godb"
 )
 
 var data = [][]byte{
@@ -86,6 +88,23 @@ var types = []string{
 	`TINYINT`,
 }
 
+func BenchmarkToJSON(b *testing.B) {
+	row := make([]interface{}, len(data))
+	for k, v := range data {
+		row[k] = v
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		rows := godb.NewFakeRows(cols...).WithTypes(types...).AddRow(row...)
+		b.StartTimer()
+
+		if _, err := godb.ToJSON(rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkToJSONSumFirst(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// N-1 for each element separator, 2 for Open/Close object.
@@ -0,0 +1,522 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+var (
+	_ Database      = (*CircuitBreakerDB)(nil)
+	_ TransactionDB = (*CircuitBreakerTxDB)(nil)
+	_ Fetcher       = (*CircuitBreakerFetcher)(nil)
+	_ JSONFetcher   = (*CircuitBreakerJSONFetcher)(nil)
+
+	// ErrCircuitOpen is returned without contacting the datastore while a circuit breaker is open.
+	ErrCircuitOpen = errors.New("godb circuit open")
+)
+
+// CircuitState is the current state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed allows all calls through and records their outcome.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all calls with ErrCircuitOpen until the OpenTimeout has elapsed.
+	CircuitOpen
+	// CircuitHalfOpen probes the datastore with Ping to decide whether to close or re-open.
+	CircuitHalfOpen
+)
+
+// String returns a human readable name for the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreakerConfig controls when a CircuitBreaker trips and how it recovers.
+// Zero values are replaced by the defaults noted on each field.
+type CircuitBreakerConfig struct {
+	// Window is the number of most recent calls considered when calculating the failure rate. Default 100.
+	Window int
+
+	// MinRequests is the number of calls in the window required before the breaker may trip. Default 10.
+	MinRequests int
+
+	// FailureRate is the fraction (0, 1] of failed calls in the window that trips the breaker. Default 0.5.
+	FailureRate float64
+
+	// OpenTimeout is how long the breaker stays open before probing with Ping. Default 30 seconds.
+	// The breaker closes only if the probe succeeds; any error re-opens it.
+	OpenTimeout time.Duration
+
+	// IsFailure decides whether an error from a call counts against the datastore. It is not consulted for the probe.
+	// Defaults to ignoring nil, sql.ErrNoRows, context.Canceled, and any *APIError with a status below 500 other than 429,
+	// which includes ErrNotFound, ErrConflict and ErrUnprocessableEntity.
+	IsFailure func(error) bool
+
+	// OnStateChange, if set, is called after every state transition.
+	OnStateChange func(from, to CircuitState)
+}
+
+// CircuitBreakerStats is a point in time view of a CircuitBreaker, suitable for dashboards.
+type CircuitBreakerStats struct {
+	State    CircuitState
+	Requests int
+	Failures int
+	OpenedAt time.Time
+}
+
+// CircuitBreaker tracks the failure rate of calls to a datastore and fails fast once it trips.
+// A CircuitBreaker is safe for concurrent use.
+type CircuitBreaker struct {
+	cfg CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	outcomes []bool
+	next     int
+	requests int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker using the given configuration.
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.Window <= 0 {
+		cfg.Window = 100
+	}
+
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+
+	if cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = cfg.Window
+	}
+
+	if cfg.FailureRate <= 0 || cfg.FailureRate > 1 {
+		cfg.FailureRate = 0.5
+	}
+
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = isBreakerFailure
+	}
+
+	return &CircuitBreaker{
+		cfg:      cfg,
+		outcomes: make([]bool, cfg.Window),
+	}
+}
+
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Client errors say nothing about the health of the upstream, except that it wants us to slow down.
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrConflict), errors.Is(err, ErrUnprocessableEntity):
+		return false
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, context.Canceled):
+		return false
+	}
+
+	return true
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	if cb == nil {
+		return CircuitClosed
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.cfg.OpenTimeout {
+		return CircuitHalfOpen
+	}
+
+	return cb.state
+}
+
+// Snapshot returns the current state and the request/failure counts in the window.
+func (cb *CircuitBreaker) Snapshot() CircuitBreakerStats {
+	if cb == nil {
+		return CircuitBreakerStats{}
+	}
+
+	state := cb.State()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return CircuitBreakerStats{
+		State:    state,
+		Requests: cb.requests,
+		Failures: cb.failures,
+		OpenedAt: cb.openedAt,
+	}
+}
+
+// Reset forces the breaker closed and clears the window.
+func (cb *CircuitBreaker) Reset() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	from := cb.state
+	cb.close()
+	cb.mu.Unlock()
+
+	cb.notify(from, CircuitClosed)
+}
+
+// allow reports whether a call may proceed. When the open timeout has elapsed, the first caller
+// probes the datastore with ping; all other callers are rejected until the probe completes.
+// The probe is detached from the caller's cancellation and bounded by the query limit, and the breaker
+// only closes if it succeeds, so a caller that has gone away cannot close the breaker.
+func (cb *CircuitBreaker) allow(ctx context.Context, ping func(context.Context) error) error {
+	cb.mu.Lock()
+
+	if cb.state == CircuitClosed {
+		cb.mu.Unlock()
+		return nil
+	}
+
+	if cb.probing || time.Since(cb.openedAt) < cb.cfg.OpenTimeout {
+		cb.mu.Unlock()
+		return ErrCircuitOpen
+	}
+
+	from := cb.state
+	cb.state = CircuitHalfOpen
+	cb.probing = true
+	cb.mu.Unlock()
+
+	cb.notify(from, CircuitHalfOpen)
+
+	pctx, cancel := context.WithTimeout(detachedContext{ctx}, queryTimeout(ctx, 0))
+	err := ping(pctx)
+	cancel()
+
+	cb.mu.Lock()
+	cb.probing = false
+	if err != nil {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+		cb.mu.Unlock()
+
+		cb.notify(CircuitHalfOpen, CircuitOpen)
+		return fmt.Errorf("%w: %v", ErrCircuitOpen, err)
+	}
+
+	cb.close()
+	cb.mu.Unlock()
+
+	cb.notify(CircuitHalfOpen, CircuitClosed)
+	return nil
+}
+
+// detachedContext keeps the values of a context, but not its deadline or cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// record adds the outcome of a call to the window and trips the breaker if needed.
+func (cb *CircuitBreaker) record(err error) {
+	failed := cb.cfg.IsFailure(err)
+
+	cb.mu.Lock()
+
+	if cb.state != CircuitClosed {
+		cb.mu.Unlock()
+		return
+	}
+
+	if cb.requests == len(cb.outcomes) {
+		if cb.outcomes[cb.next] {
+			cb.failures--
+		}
+	} else {
+		cb.requests++
+	}
+
+	cb.outcomes[cb.next] = failed
+	cb.next = (cb.next + 1) % len(cb.outcomes)
+
+	if failed {
+		cb.failures++
+	}
+
+	if cb.requests < cb.cfg.MinRequests || float64(cb.failures)/float64(cb.requests) < cb.cfg.FailureRate {
+		cb.mu.Unlock()
+		return
+	}
+
+	cb.state = CircuitOpen
+	cb.openedAt = time.Now()
+	cb.mu.Unlock()
+
+	cb.notify(CircuitClosed, CircuitOpen)
+}
+
+// close must be called with cb.mu held.
+func (cb *CircuitBreaker) close() {
+	cb.state = CircuitClosed
+	cb.openedAt = time.Time{}
+	cb.probing = false
+	cb.requests = 0
+	cb.failures = 0
+	cb.next = 0
+	for i := range cb.outcomes {
+		cb.outcomes[i] = false
+	}
+}
+
+func (cb *CircuitBreaker) notify(from, to CircuitState) {
+	if from != to && cb.cfg.OnStateChange != nil {
+		cb.cfg.OnStateChange(from, to)
+	}
+}
+
+// CircuitBreakerDB wraps a Database with a CircuitBreaker.
+// Ping, Stats and Shutdown always pass through to the underlying Database.
+type CircuitBreakerDB struct {
+	*CircuitBreaker
+
+	db Database
+}
+
+// NewCircuitBreakerDB returns a Database that fails fast with ErrCircuitOpen while db is unhealthy.
+// The returned Database is a *CircuitBreakerDB, or a *CircuitBreakerTxDB if db is a TransactionDB.
+func NewCircuitBreakerDB(db Database, cfg CircuitBreakerConfig) Database {
+	c := &CircuitBreakerDB{
+		CircuitBreaker: NewCircuitBreaker(cfg),
+		db:             db,
+	}
+
+	if tdb, ok := db.(TransactionDB); ok {
+		return &CircuitBreakerTxDB{CircuitBreakerDB: c, tdb: tdb}
+	}
+
+	return c
+}
+
+// Ping sends a ping to the server and returns an error if it cannot connect.
+func (c *CircuitBreakerDB) Ping(ctx context.Context) error {
+	if c == nil || c.db == nil {
+		return ErrEmptyObject
+	}
+
+	return c.db.Ping(ctx)
+}
+
+// Shutdown performs any closing operations on the underlying Database.
+func (c *CircuitBreakerDB) Shutdown(ctx context.Context) error {
+	if c == nil || c.db == nil {
+		return ErrEmptyObject
+	}
+
+	return c.db.Shutdown(ctx)
+}
+
+// Stats returns statistics about the underlying Database connection.
+func (c *CircuitBreakerDB) Stats(ctx context.Context) sql.DBStats {
+	if c == nil || c.db == nil {
+		return sql.DBStats{}
+	}
+
+	return c.db.Stats(ctx)
+}
+
+// Fetch provides a simple query-and-get operation. We will run your query and fill your container.
+func (c *CircuitBreakerDB) Fetch(ctx context.Context, query string, container interface{}, args ...interface{}) error {
+	return c.FetchWithMetrics(ctx, &metrics.NoOp{}, query, container, args...)
+}
+
+// FetchWithMetrics provides a simple query-and-get operation. We will run your query and fill your container.
+func (c *CircuitBreakerDB) FetchWithMetrics(ctx context.Context, r metrics.Recorder, query string, container interface{}, args ...interface{}) error {
+	if c == nil || c.db == nil {
+		return ErrEmptyObject
+	}
+
+	if err := c.allow(ctx, c.db.Ping); err != nil {
+		return err
+	}
+
+	err := c.db.FetchWithMetrics(ctx, r, query, container, args...)
+	c.record(err)
+	return err
+}
+
+// FetchJSON provides a simple query-and-get operation. We will run your query and give you back the JSON representing your result set.
+func (c *CircuitBreakerDB) FetchJSON(ctx context.Context, query string, args ...interface{}) ([]byte, error) {
+	return c.FetchJSONWithMetrics(ctx, &metrics.NoOp{}, query, args...)
+}
+
+// FetchJSONWithMetrics provides a simple query-and-get operation. We will run your query and give you back the JSON representing your result set.
+func (c *CircuitBreakerDB) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder, query string, args ...interface{}) ([]byte, error) {
+	if c == nil || c.db == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if err := c.allow(ctx, c.db.Ping); err != nil {
+		return nil, err
+	}
+
+	b, err := c.db.FetchJSONWithMetrics(ctx, r, query, args...)
+	c.record(err)
+	return b, err
+}
+
+// Exec provides a simple no-return-expected query. We will run your query and send you on your way.
+func (c *CircuitBreakerDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecWithMetrics(ctx, &metrics.NoOp{}, query, args...)
+}
+
+// ExecWithMetrics provides a simple no-return-expected query. We will run your query and send you on your way.
+func (c *CircuitBreakerDB) ExecWithMetrics(ctx context.Context, r metrics.Recorder, query string, args ...interface{}) (sql.Result, error) {
+	if c == nil || c.db == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if err := c.allow(ctx, c.db.Ping); err != nil {
+		return nil, err
+	}
+
+	res, err := c.db.ExecWithMetrics(ctx, r, query, args...)
+	c.record(err)
+	return res, err
+}
+
+// CircuitBreakerTxDB is a CircuitBreakerDB wrapping a TransactionDB.
+type CircuitBreakerTxDB struct {
+	*CircuitBreakerDB
+
+	tdb TransactionDB
+}
+
+// BeginTx starts a transaction on the underlying TransactionDB.
+// The returned Transaction is not guarded by the breaker, but failing to begin counts as a failure.
+func (c *CircuitBreakerTxDB) BeginTx(ctx context.Context) (Transaction, error) {
+	if c == nil || c.CircuitBreakerDB == nil || c.tdb == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if err := c.allow(ctx, c.db.Ping); err != nil {
+		return nil, err
+	}
+
+	tx, err := c.tdb.BeginTx(ctx)
+	c.record(err)
+	return tx, err
+}
+
+// CircuitBreakerFetcher wraps a Fetcher, such as JSONApi, with a CircuitBreaker.
+type CircuitBreakerFetcher struct {
+	*CircuitBreaker
+
+	f Fetcher
+}
+
+// NewCircuitBreakerFetcher returns a Fetcher that fails fast with ErrCircuitOpen while f is unhealthy.
+// The returned Fetcher is a *CircuitBreakerFetcher, or a *CircuitBreakerJSONFetcher if f is also a JSONFetcher.
+func NewCircuitBreakerFetcher(f Fetcher, cfg CircuitBreakerConfig) Fetcher {
+	c := &CircuitBreakerFetcher{
+		CircuitBreaker: NewCircuitBreaker(cfg),
+		f:              f,
+	}
+
+	if jf, ok := f.(jsonFetcher); ok {
+		return &CircuitBreakerJSONFetcher{CircuitBreakerFetcher: c, jf: jf}
+	}
+
+	return c
+}
+
+// Ping sends a ping to the server and returns an error if it cannot connect.
+func (c *CircuitBreakerFetcher) Ping(ctx context.Context) error {
+	if c == nil || c.f == nil {
+		return ErrEmptyObject
+	}
+
+	return c.f.Ping(ctx)
+}
+
+// Fetch retrieves the requested resource and fills your container.
+func (c *CircuitBreakerFetcher) Fetch(ctx context.Context, requestURI string, container interface{}, args ...interface{}) error {
+	return c.FetchWithMetrics(ctx, &metrics.NoOp{}, requestURI, container, args...)
+}
+
+// FetchWithMetrics retrieves the requested resource and fills your container.
+func (c *CircuitBreakerFetcher) FetchWithMetrics(ctx context.Context, r metrics.Recorder, requestURI string, container interface{}, args ...interface{}) error {
+	if c == nil || c.f == nil {
+		return ErrEmptyObject
+	}
+
+	if err := c.allow(ctx, c.f.Ping); err != nil {
+		return err
+	}
+
+	err := c.f.FetchWithMetrics(ctx, r, requestURI, container, args...)
+	c.record(err)
+	return err
+}
+
+// CircuitBreakerJSONFetcher is a CircuitBreakerFetcher wrapping a JSONFetcher.
+type CircuitBreakerJSONFetcher struct {
+	*CircuitBreakerFetcher
+
+	jf jsonFetcher
+}
+
+// FetchJSON retrieves the requested resource as JSON.
+func (c *CircuitBreakerJSONFetcher) FetchJSON(ctx context.Context, requestURI string, args ...interface{}) ([]byte, error) {
+	return c.FetchJSONWithMetrics(ctx, &metrics.NoOp{}, requestURI, args...)
+}
+
+// FetchJSONWithMetrics retrieves the requested resource as JSON.
+func (c *CircuitBreakerJSONFetcher) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder, requestURI string, args ...interface{}) ([]byte, error) {
+	if c == nil || c.CircuitBreakerFetcher == nil || c.jf == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if err := c.allow(ctx, c.f.Ping); err != nil {
+		return nil, err
+	}
+
+	b, err := c.jf.FetchJSONWithMetrics(ctx, r, requestURI, args...)
+	c.record(err)
+	return b, err
+}
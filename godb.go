@@ -42,11 +42,13 @@ var (
 	_ Executer = (*PostgresDatastore)(nil)
 	_ Executer = (*MSSQLDatastore)(nil)
 	_ Executer = (*SQLiteDatastore)(nil)
+	_ Executer = (*JSONApi)(nil)
 )
 
 var (
 	// QueryLimit is a hard timeout on the amount of time a query is allowed to run.
 	// QueryLimit is exported so that an application can adjust it to fit their needs.
+	// QueryLimit is only used when neither the context nor the datastore specifies a limit. See WithQueryLimit and SetQueryLimit.
 	QueryLimit = 5 * time.Minute
 
 	ErrEmptyObject = errors.New("godb empty object")
@@ -114,12 +116,31 @@ type stats interface {
 	Stats(context.Context) sql.DBStats
 }
 
+type queryLimitKey struct{}
+
+// WithQueryLimit returns a context that overrides the datastore's query limit for any call made with it.
+// The limit is only applied when the context has no deadline of its own.
+func WithQueryLimit(ctx context.Context, limit time.Duration) context.Context {
+	return context.WithValue(ctx, queryLimitKey{}, limit)
+}
+
+// queryTimeout chooses the timeout for a single call: the context override, then the datastore limit, then QueryLimit.
+func queryTimeout(ctx context.Context, limit time.Duration) time.Duration {
+	if d, ok := ctx.Value(queryLimitKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+
+	if limit > 0 {
+		return limit
+	}
+
+	return QueryLimit
+}
+
 func assertDeepEqual(t *testing.T, a, b interface{}) bool {
 	if !assert.ObjectsAreEqual(a, b) {
 		diff := strings.Join(deep.Equal(a, b), "\n\t")
-		assert.FailNow(t, fmt.Sprintf("Diff:\n\t%s", diff))
-
-		return false
+		return assert.Fail(t, fmt.Sprintf("Diff:\n\t%s", diff))
 	}
 
 	return true
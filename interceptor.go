@@ -0,0 +1,277 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/btm6084/utilities/metrics"
+)
+
+// Interface Assertions
+var (
+	_ Database      = (*wrappedDB)(nil)
+	_ TransactionDB = (*wrappedTxDB)(nil)
+	_ Transaction   = (*wrappedTx)(nil)
+)
+
+// Operation names reported in QueryInfo.Operation.
+const (
+	OpFetch     = "Fetch"
+	OpFetchJSON = "FetchJSON"
+	OpExec      = "Exec"
+	OpBeginTx   = "BeginTx"
+	OpCommit    = "Commit"
+	OpRollback  = "Rollback"
+)
+
+// QueryInfo describes a single call made through a Database returned by Wrap.
+// Before hooks see Query, Args, Operation and InTx; After hooks additionally see Duration, RowsAffected and Err.
+type QueryInfo struct {
+	Operation string
+	Query     string
+	Args      []interface{}
+
+	// InTx is true when the call was made on a Transaction returned by BeginTx.
+	InTx bool
+
+	Duration time.Duration
+
+	// RowsAffected is only populated for Exec, and is -1 when it is unknown.
+	RowsAffected int64
+
+	Err error
+}
+
+// Interceptor hooks into every Fetch, FetchJSON, Exec, BeginTx, Commit and Rollback made through a Database returned by Wrap.
+// Before may return a derived context, which is passed to the underlying call and to After.
+// If Before returns an error, the call is not made, its context is discarded, and the error is returned to the caller.
+type Interceptor interface {
+	Before(ctx context.Context, info *QueryInfo) (context.Context, error)
+	After(ctx context.Context, info *QueryInfo)
+}
+
+// InterceptorFuncs adapts plain functions to the Interceptor interface. Either function may be nil.
+type InterceptorFuncs struct {
+	BeforeFunc func(ctx context.Context, info *QueryInfo) (context.Context, error)
+	AfterFunc  func(ctx context.Context, info *QueryInfo)
+}
+
+// Before calls BeforeFunc if it is set.
+func (f InterceptorFuncs) Before(ctx context.Context, info *QueryInfo) (context.Context, error) {
+	if f.BeforeFunc == nil {
+		return ctx, nil
+	}
+
+	return f.BeforeFunc(ctx, info)
+}
+
+// After calls AfterFunc if it is set.
+func (f InterceptorFuncs) After(ctx context.Context, info *QueryInfo) {
+	if f.AfterFunc != nil {
+		f.AfterFunc(ctx, info)
+	}
+}
+
+// Wrap returns a Database that runs each interceptor around every call to db.
+// Before hooks run in the order given and After hooks run in reverse order.
+// If db is a TransactionDB, the returned Database is also a TransactionDB and the Transactions it begins are wrapped too.
+// Ping, Stats and Shutdown are passed through without interception.
+func Wrap(db Database, interceptors ...Interceptor) Database {
+	w := &wrappedDB{db: db, interceptors: interceptors}
+
+	if tdb, ok := db.(TransactionDB); ok {
+		return &wrappedTxDB{wrappedDB: w, tdb: tdb}
+	}
+
+	return w
+}
+
+type wrappedDB struct {
+	db           Database
+	interceptors []Interceptor
+	inTx         bool
+}
+
+// intercept runs call between the Before and After hooks of every interceptor.
+func (w *wrappedDB) intercept(ctx context.Context, info *QueryInfo, call func(context.Context) error) error {
+	info.InTx = w.inTx
+	info.RowsAffected = -1
+
+	ran := 0
+	for _, i := range w.interceptors {
+		c, err := i.Before(ctx, info)
+		if err != nil {
+			info.Err = err
+			break
+		}
+		ctx = c
+		ran++
+	}
+
+	if info.Err == nil {
+		start := time.Now()
+		info.Err = call(ctx)
+		info.Duration = time.Since(start)
+	}
+
+	for k := ran - 1; k >= 0; k-- {
+		w.interceptors[k].After(ctx, info)
+	}
+
+	return info.Err
+}
+
+func (w *wrappedDB) Ping(ctx context.Context) error {
+	return w.db.Ping(ctx)
+}
+
+func (w *wrappedDB) Shutdown(ctx context.Context) error {
+	return w.db.Shutdown(ctx)
+}
+
+func (w *wrappedDB) Stats(ctx context.Context) sql.DBStats {
+	return w.db.Stats(ctx)
+}
+
+func (w *wrappedDB) Fetch(ctx context.Context, query string, container interface{}, args ...interface{}) error {
+	info := &QueryInfo{Operation: OpFetch, Query: query, Args: args}
+	return w.intercept(ctx, info, func(ctx context.Context) error {
+		return w.db.Fetch(ctx, query, container, args...)
+	})
+}
+
+func (w *wrappedDB) FetchWithMetrics(ctx context.Context, r metrics.Recorder, query string, container interface{}, args ...interface{}) error {
+	info := &QueryInfo{Operation: OpFetch, Query: query, Args: args}
+	return w.intercept(ctx, info, func(ctx context.Context) error {
+		return w.db.FetchWithMetrics(ctx, r, query, container, args...)
+	})
+}
+
+func (w *wrappedDB) FetchJSON(ctx context.Context, query string, args ...interface{}) ([]byte, error) {
+	var b []byte
+	info := &QueryInfo{Operation: OpFetchJSON, Query: query, Args: args}
+	err := w.intercept(ctx, info, func(ctx context.Context) error {
+		var err error
+		b, err = w.db.FetchJSON(ctx, query, args...)
+		return err
+	})
+
+	return b, err
+}
+
+func (w *wrappedDB) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder, query string, args ...interface{}) ([]byte, error) {
+	var b []byte
+	info := &QueryInfo{Operation: OpFetchJSON, Query: query, Args: args}
+	err := w.intercept(ctx, info, func(ctx context.Context) error {
+		var err error
+		b, err = w.db.FetchJSONWithMetrics(ctx, r, query, args...)
+		return err
+	})
+
+	return b, err
+}
+
+func (w *wrappedDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	info := &QueryInfo{Operation: OpExec, Query: query, Args: args}
+	err := w.intercept(ctx, info, func(ctx context.Context) error {
+		var err error
+		res, err = w.db.Exec(ctx, query, args...)
+		info.RowsAffected = rowsAffected(res, err)
+		return err
+	})
+
+	return res, err
+}
+
+func (w *wrappedDB) ExecWithMetrics(ctx context.Context, r metrics.Recorder, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	info := &QueryInfo{Operation: OpExec, Query: query, Args: args}
+	err := w.intercept(ctx, info, func(ctx context.Context) error {
+		var err error
+		res, err = w.db.ExecWithMetrics(ctx, r, query, args...)
+		info.RowsAffected = rowsAffected(res, err)
+		return err
+	})
+
+	return res, err
+}
+
+func rowsAffected(res sql.Result, err error) int64 {
+	if err != nil || res == nil {
+		return -1
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+
+	return n
+}
+
+type wrappedTxDB struct {
+	*wrappedDB
+
+	tdb TransactionDB
+}
+
+func (w *wrappedTxDB) BeginTx(ctx context.Context) (Transaction, error) {
+	var tx Transaction
+	info := &QueryInfo{Operation: OpBeginTx}
+	err := w.intercept(ctx, info, func(ctx context.Context) error {
+		var err error
+		tx, err = w.tdb.BeginTx(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if tx == nil {
+		return nil, fmt.Errorf("godb: %T returned a nil transaction", w.tdb)
+	}
+
+	return &wrappedTx{
+		wrappedDB: &wrappedDB{db: tx, interceptors: w.interceptors, inTx: true},
+		tx:        tx,
+		ctx:       ctx,
+	}, nil
+}
+
+type wrappedTx struct {
+	*wrappedDB
+
+	tx Transaction
+
+	// ctx is the context BeginTx was called with. Commit and Rollback take no context,
+	// so interceptors are given this one to tie them back to the caller.
+	ctx context.Context
+
+	// done is set once Commit or Rollback has been called.
+	done bool
+}
+
+func (w *wrappedTx) Commit() error {
+	info := &QueryInfo{Operation: OpCommit}
+	return w.intercept(w.ctx, info, func(context.Context) error {
+		w.done = true
+		return w.tx.Commit()
+	})
+}
+
+// Rollback is not intercepted once the transaction has finished, so that the usual deferred Rollback
+// after a Commit, which returns sql.ErrTxDone, is not reported to interceptors as a failure.
+func (w *wrappedTx) Rollback() error {
+	if w.done {
+		return w.tx.Rollback()
+	}
+
+	info := &QueryInfo{Operation: OpRollback}
+	return w.intercept(w.ctx, info, func(context.Context) error {
+		w.done = true
+		return w.tx.Rollback()
+	})
+}
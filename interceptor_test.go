@@ -0,0 +1,70 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type traceKey struct{}
+
+func TestInterceptorBeforeRejects(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	var calls []string
+	tracer := InterceptorFuncs{
+		BeforeFunc: func(ctx context.Context, info *QueryInfo) (context.Context, error) {
+			calls = append(calls, "trace.Before")
+			return context.WithValue(ctx, traceKey{}, "span"), nil
+		},
+		AfterFunc: func(ctx context.Context, info *QueryInfo) {
+			calls = append(calls, "trace.After")
+			if assert.NotNil(t, ctx) {
+				assert.Equal(t, "span", ctx.Value(traceKey{}))
+			}
+			assert.Equal(t, errDenied, info.Err)
+		},
+	}
+
+	deny := InterceptorFuncs{
+		BeforeFunc: func(ctx context.Context, info *QueryInfo) (context.Context, error) {
+			calls = append(calls, "deny.Before")
+			return nil, errDenied
+		},
+		AfterFunc: func(ctx context.Context, info *QueryInfo) {
+			calls = append(calls, "deny.After")
+		},
+	}
+
+	m := NewMockDB(t)
+	db := Wrap(m, tracer, deny)
+
+	_, err := db.FetchJSON(context.Background(), "SELECT 1")
+	assert.Equal(t, errDenied, err)
+	assert.Equal(t, []string{"trace.Before", "deny.Before", "trace.After"}, calls)
+	assert.Equal(t, 0, m.FetchJSONCount)
+}
+
+func TestInterceptorRollbackAfterCommit(t *testing.T) {
+	var ops []string
+	rec := InterceptorFuncs{
+		AfterFunc: func(ctx context.Context, info *QueryInfo) {
+			ops = append(ops, info.Operation)
+			assert.NoError(t, info.Err, info.Operation)
+		},
+	}
+
+	db := Wrap(NewMockDB(t), rec).(TransactionDB)
+
+	tx, err := db.BeginTx(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, tx.Commit())
+	assert.ErrorIs(t, tx.Rollback(), sql.ErrTxDone)
+	assert.Equal(t, []string{OpBeginTx, OpCommit}, ops)
+}
@@ -1,38 +1,79 @@
 package godb
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/btm6084/gojson"
 	"github.com/btm6084/utilities/metrics"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 var (
 	stripQueryRE = regexp.MustCompile(`^[^?]+`)
-	ErrNotFound  = errors.New("not found")
+
+	ErrNotFound            = errors.New("not found")
+	ErrConflict            = errors.New("conflict")
+	ErrUnprocessableEntity = errors.New("unprocessable entity")
+
+	ErrResponseTooLarge = errors.New("godb response too large")
+	ErrNotJSON          = errors.New("godb response is not JSON")
+
+	// MaxResponseSize is the default limit on the decoded size of a JSONApi response body. See WithMaxResponseSize.
+	// MaxResponseSize is exported so that an application can adjust it to fit their needs.
+	MaxResponseSize int64 = 64 << 20
 )
 
-// JSONApi is an implementation of the Fetcher and JSONFetcher interfaces()
+// JSONApi is an implementation of the Fetcher, JSONFetcher and Executer interfaces()
+// Every request is made with the caller's context, so cancellation, deadlines and trace propagation all apply.
 type JSONApi struct {
-	baseURL  string
-	pingPath string
-	client   http.Client
+	baseURL    string
+	pingPath   string
+	client     http.Client
+	queryLimit time.Duration
+
+	// transport is configured by the transport options, unless roundTripper replaces it entirely.
+	transport    *http.Transport
+	roundTripper http.RoundTripper
+
+	headers     http.Header
+	headerFuncs []func(context.Context, http.Header) error
+	cache       *ResponseCache
+
+	maxResponseSize int64
+	retry           *RetryPolicy
+	limiter         *tokenBucket
 }
 
+// JSONApiOption configures optional JSONApi behaviour. See NewJSONApi.
+type JSONApiOption func(*JSONApi)
+
 // NewJSONApi configures and returns a usable JSONApi with a baseURL and pingPath.
 // baseURL should include an appropriate scheme and hostname.
 // pingPath is the path relative to the baseURL that can be used to verify the API is reachable;
 // pingPath should always return an HTTP 200 OK status
-func NewJSONApi(baseURL, pingPath string, requestTimeout time.Duration) *JSONApi {
+// requestTimeout is the default timeout for each request, and may be overridden per call with WithQueryLimit.
+// A requestTimeout of zero falls back to QueryLimit.
+// Any opts are applied in order after the defaults are configured.
+func NewJSONApi(baseURL, pingPath string, requestTimeout time.Duration, opts ...JSONApiOption) *JSONApi {
 	baseURL = strings.TrimRight(baseURL, "/")
 	pingPath = strings.TrimLeft(pingPath, "/")
 
@@ -42,12 +83,21 @@ func NewJSONApi(baseURL, pingPath string, requestTimeout time.Duration) *JSONApi
 	t.MaxIdleConnsPerHost = 100
 
 	fetcher := &JSONApi{
-		baseURL:  baseURL,
-		pingPath: pingPath,
-		client: http.Client{
-			Timeout:   requestTimeout,
-			Transport: t,
-		},
+		baseURL:         baseURL,
+		pingPath:        pingPath,
+		queryLimit:      requestTimeout,
+		transport:       t,
+		headers:         http.Header{},
+		maxResponseSize: MaxResponseSize,
+	}
+
+	for _, opt := range opts {
+		opt(fetcher)
+	}
+
+	fetcher.client.Transport = fetcher.transport
+	if fetcher.roundTripper != nil {
+		fetcher.client.Transport = fetcher.roundTripper
 	}
 
 	return fetcher
@@ -64,26 +114,157 @@ func (j *JSONApi) requestURL(path string) string {
 	}, "/")
 }
 
-func readResponse(res *http.Response) ([]byte, error) {
-	// Decompress gzip content
-	var err error
-	var rawBody io.ReadCloser
-	switch res.Header.Get("Content-Encoding") {
-	case "gzip":
-		rawBody, err = gzip.NewReader(res.Body)
+// readResponse decodes the response body according to its Content-Encoding and verifies it is JSON.
+// At most limit bytes are read after decoding; a limit of zero or less means no limit.
+func readResponse(res *http.Response, limit int64) ([]byte, error) {
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+
+	body, closeBody, err := decodeBody(res.Body, res.Header.Values("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeBody()
+
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("godb.JSONApi: reading %s response body: %w", res.Header.Get("Content-Encoding"), err)
+	}
+
+	if limit > 0 && int64(len(b)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, limit)
+	}
+
+	if ct := res.Header.Get("Content-Type"); ct != "" && len(b) > 0 && !isJSONContentType(ct) {
+		return nil, fmt.Errorf("%w: Content-Type %q: %s", ErrNotJSON, ct, truncate(b, 200))
+	}
+
+	return b, nil
+}
+
+// decodeBody wraps body in a decoder for each content coding, in the reverse of the order they were applied.
+// The returned func releases the decoders.
+func decodeBody(body io.Reader, encodings []string) (io.Reader, func(), error) {
+	var codings []string
+	for _, e := range encodings {
+		for _, c := range strings.Split(e, ",") {
+			if c = strings.ToLower(strings.TrimSpace(c)); c != "" && c != "identity" {
+				codings = append(codings, c)
+			}
+		}
+	}
+
+	var closers []func()
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	for k := len(codings) - 1; k >= 0; k-- {
+		var err error
+		switch codings[k] {
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(body)
+		case "deflate":
+			body, err = newDeflateReader(body)
+		case "br":
+			body = brotli.NewReader(body)
+		case "zstd":
+			var z *zstd.Decoder
+			z, err = zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+			if err == nil {
+				body = z
+				closers = append(closers, z.Close)
+			}
+		default:
+			closeAll()
+			return nil, nil, fmt.Errorf("godb.JSONApi: unsupported Content-Encoding %q", codings[k])
+		}
+
 		if err != nil {
-			rawBody = res.Body
+			closeAll()
+			return nil, nil, fmt.Errorf("godb.JSONApi: invalid %s response body: %w", codings[k], err)
 		}
-	default:
-		rawBody = res.Body
 	}
 
-	b, err := ioutil.ReadAll(rawBody)
+	return body, closeAll, nil
+}
+
+// newDeflateReader reads "deflate" content, which should be zlib wrapped (RFC 9110),
+// but which some servers send as raw DEFLATE.
+func newDeflateReader(body io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(body)
+
+	header, err := br.Peek(2)
 	if err != nil {
 		return nil, err
 	}
 
-	return b, nil
+	// A zlib stream starts with a CMF byte for DEFLATE (low nibble 8) and a header checksum that is a multiple of 31.
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
+
+func isJSONContentType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+func truncate(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+
+	return append(b[:n:n], "..."...)
+}
+
+// WithMaxResponseSize limits the decoded size of response bodies read by the JSONApi.
+// Larger responses fail with ErrResponseTooLarge. A limit of zero or less removes the limit.
+func WithMaxResponseSize(limit int64) JSONApiOption {
+	return func(j *JSONApi) {
+		j.maxResponseSize = limit
+	}
+}
+
+// setHeaders adds the configured static and per-request headers, and the trace propagation headers, to req.
+func (j *JSONApi) setHeaders(ctx context.Context, req *http.Request) error {
+	for k, v := range j.headers {
+		req.Header[k] = append([]string(nil), v...)
+	}
+
+	for _, f := range j.headerFuncs {
+		if err := f(ctx, req.Header); err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return nil
+}
+
+// contextError wraps err with the context's error when the request failed because ctx was cancelled or timed out,
+// matching the errors returned by the SQL datastores.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+
+	return err
 }
 
 // Ping sends a ping to the server and returns an error if it cannot connect.
@@ -92,11 +273,28 @@ func (j *JSONApi) Ping(ctx context.Context) error {
 		return ErrEmptyObject
 	}
 
-	res, err := j.client.Get(j.requestURL(j.pingPath))
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, j.queryLimit))
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", j.requestURL(j.pingPath), nil)
 	if err != nil {
 		return err
 	}
 
+	if err := j.setHeaders(ctx, req); err != nil {
+		return err
+	}
+
+	res, err := j.client.Do(req)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	defer res.Body.Close()
+
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("invalid API ping status: %d %s", res.StatusCode, res.Status)
 	}
@@ -106,7 +304,7 @@ func (j *JSONApi) Ping(ctx context.Context) error {
 
 // FetchJSON makes a request to baseURL/requestURI.
 // RequestURI should be the full relative path + query string.
-// Any args passed in will be passed to fmt.Sprintf(requestURI, args...)
+// Any args passed in will be passed to fmt.Sprintf(requestURI, args...) without escaping; use FetchRequest for user supplied values.
 func (j *JSONApi) FetchJSON(ctx context.Context, requestURI string, args ...interface{}) ([]byte, error) {
 	if j == nil {
 		return nil, ErrEmptyObject
@@ -123,46 +321,98 @@ func (j *JSONApi) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder,
 		return nil, ErrEmptyObject
 	}
 
-	r.SetDBMeta(j.baseURL, stripQueryRE.FindString(requestURI), "GET")
+	res, err := j.do(ctx, r, http.MethodGet, requestURI, fmt.Sprintf(requestURI, args...), nil, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// do sends a single request to baseURL/path and reads the response.
+// label is the unexpanded request path reported to metrics, along with args.
+// Error responses are returned as an *APIError.
+func (j *JSONApi) do(ctx context.Context, r metrics.Recorder, method, label, path string, body []byte, args []interface{}) (*APIResult, error) {
+	r.SetDBMeta(j.baseURL, stripQueryRE.FindString(label), method)
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, j.queryLimit))
+		defer cancel()
+	}
+
+	href := j.requestURL(path)
 
-	href := j.requestURL(fmt.Sprintf(requestURI, args...))
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
 
-	req, err := http.NewRequest("GET", href, nil)
+	req, err := http.NewRequestWithContext(ctx, method, href, reqBody)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-	end := r.DatabaseSegment(j.baseURL, requestURI, args...)
-	res, err := j.client.Do(req)
+	if err := j.setHeaders(ctx, req); err != nil {
+		return nil, err
+	}
+
+	var cached *cacheEntry
+	if j.cache != nil && method == http.MethodGet {
+		var fresh bool
+		cached, fresh = j.cache.lookup(req)
+		if fresh {
+			end := r.Segment("GODB::JSONApi::CacheHit")
+			end()
+			return j.cache.result(cached), nil
+		}
+	}
+
+	end := r.DatabaseSegment(j.baseURL, label, args...)
+	res, err := j.roundTrip(ctx, req)
 	end()
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 
 	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
+	if cached != nil && res.StatusCode == http.StatusNotModified {
+		j.cache.refresh(cached, label, res.Header)
+		return j.cache.result(cached), nil
+	}
+
+	if j.cache != nil && method == http.MethodGet {
+		j.cache.miss()
 	}
 
 	if res.StatusCode/100 > 3 {
-		return nil, fmt.Errorf("godb.JSONApi: invalid status code %d (%s)", res.StatusCode, res.Status)
+		return nil, newAPIError(res)
 	}
 
-	b, err := readResponse(res)
+	b, err := readResponse(res, j.maxResponseSize)
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 
-	return b, nil
+	result := &APIResult{StatusCode: res.StatusCode, Header: res.Header, Body: b}
+
+	if j.cache != nil && method == http.MethodGet && res.StatusCode == http.StatusOK {
+		j.cache.store(req, label, result)
+	}
+
+	return result, nil
 }
 
 // Fetch makes a request to baseURL/requestURI.
 // RequestURI should be the full relative path + query string.
-// Any args passed in will be passed to fmt.Sprintf(requestURI, args...)
+// Any args passed in will be passed to fmt.Sprintf(requestURI, args...) without escaping; use FetchRequest for user supplied values.
 func (j *JSONApi) Fetch(ctx context.Context, requestURI string, container interface{}, args ...interface{}) error {
 	if j == nil {
 		return ErrEmptyObject
@@ -191,3 +441,115 @@ func (j *JSONApi) FetchWithMetrics(ctx context.Context, r metrics.Recorder, requ
 
 	return nil
 }
+
+// APIResult is the response to a JSONApi Exec or Send. It implements sql.Result.
+type APIResult struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// LastInsertId is not supported by JSON APIs and always returns 0.
+func (a *APIResult) LastInsertId() (int64, error) { return 0, nil }
+
+// RowsAffected returns 1 for any successful response.
+func (a *APIResult) RowsAffected() (int64, error) { return 1, nil }
+
+// JSONBody marks a value passed to Exec as the request body rather than an argument to fmt.Sprintf.
+// The value is encoded with encoding/json, unless it is already a []byte or json.RawMessage.
+func JSONBody(v interface{}) interface{} {
+	return jsonBody{v}
+}
+
+type jsonBody struct {
+	v interface{}
+}
+
+func encodeBody(body interface{}) ([]byte, error) {
+	switch v := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	}
+
+	return json.Marshal(body)
+}
+
+// splitMethod separates a leading HTTP method from requestURI, e.g. "PUT /users/%d". POST is used if there is none.
+func splitMethod(requestURI string) (string, string) {
+	if k := strings.IndexByte(requestURI, ' '); k > 0 {
+		switch m := strings.ToUpper(requestURI[:k]); m {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			return m, strings.TrimSpace(requestURI[k+1:])
+		}
+	}
+
+	return http.MethodPost, requestURI
+}
+
+// Exec sends a request to baseURL/requestURI and returns the response as an *APIResult.
+// RequestURI may be prefixed with the HTTP method, e.g. "PATCH /users/%d"; the default is POST.
+// An argument wrapped with JSONBody is sent as the request body. Any other args will be passed to fmt.Sprintf(requestURI, args...)
+func (j *JSONApi) Exec(ctx context.Context, requestURI string, args ...interface{}) (sql.Result, error) {
+	if j == nil {
+		return nil, ErrEmptyObject
+	}
+
+	return j.ExecWithMetrics(ctx, &metrics.NoOp{}, requestURI, args...)
+}
+
+// ExecWithMetrics sends a request to baseURL/requestURI and returns the response as an *APIResult.
+// RequestURI may be prefixed with the HTTP method, e.g. "PATCH /users/%d"; the default is POST.
+// An argument wrapped with JSONBody is sent as the request body. Any other args will be passed to fmt.Sprintf(requestURI, args...)
+func (j *JSONApi) ExecWithMetrics(ctx context.Context, r metrics.Recorder, requestURI string, args ...interface{}) (sql.Result, error) {
+	if j == nil {
+		return nil, ErrEmptyObject
+	}
+
+	var body interface{}
+	fmtArgs := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if b, ok := arg.(jsonBody); ok {
+			body = b.v
+			continue
+		}
+		fmtArgs = append(fmtArgs, arg)
+	}
+
+	method, requestURI := splitMethod(requestURI)
+
+	res, err := j.SendWithMetrics(ctx, r, method, requestURI, body, fmtArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Send makes a request to baseURL/requestURI using the given HTTP method and JSON encoded body, which may be nil.
+// Any args passed in will be passed to fmt.Sprintf(requestURI, args...)
+func (j *JSONApi) Send(ctx context.Context, method, requestURI string, body interface{}, args ...interface{}) (*APIResult, error) {
+	if j == nil {
+		return nil, ErrEmptyObject
+	}
+
+	return j.SendWithMetrics(ctx, &metrics.NoOp{}, method, requestURI, body, args...)
+}
+
+// SendWithMetrics makes a request to baseURL/requestURI using the given HTTP method and JSON encoded body, which may be nil.
+// Any args passed in will be passed to fmt.Sprintf(requestURI, args...)
+func (j *JSONApi) SendWithMetrics(ctx context.Context, r metrics.Recorder, method, requestURI string, body interface{}, args ...interface{}) (*APIResult, error) {
+	if j == nil {
+		return nil, ErrEmptyObject
+	}
+
+	b, err := encodeBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return j.do(ctx, r, strings.ToUpper(method), requestURI, fmt.Sprintf(requestURI, args...), b, args)
+}
@@ -0,0 +1,203 @@
+package godb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btm6084/gojson"
+)
+
+// WithHeader adds a static header to every request made by the JSONApi.
+func WithHeader(key, value string) JSONApiOption {
+	return func(j *JSONApi) {
+		j.headers.Add(key, value)
+	}
+}
+
+// WithHeaderFunc calls f before every request made by the JSONApi, allowing headers such as correlation IDs
+// to be taken from the request context. Returning an error aborts the request.
+func WithHeaderFunc(f func(ctx context.Context, h http.Header) error) JSONApiOption {
+	return func(j *JSONApi) {
+		j.headerFuncs = append(j.headerFuncs, f)
+	}
+}
+
+// WithBasicAuth sends HTTP basic authentication with every request made by the JSONApi.
+func WithBasicAuth(username, password string) JSONApiOption {
+	return WithHeaderFunc(func(ctx context.Context, h http.Header) error {
+		r := http.Request{Header: h}
+		r.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// WithBearerToken sends an Authorization: Bearer header with every request made by the JSONApi,
+// using a token obtained from tp.
+func WithBearerToken(tp TokenProvider) JSONApiOption {
+	return WithHeaderFunc(func(ctx context.Context, h http.Header) error {
+		token, err := tp.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("godb.JSONApi: bearer token: %w", err)
+		}
+
+		h.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// TokenProvider supplies bearer tokens to a JSONApi. Token is called before every request,
+// so implementations should cache tokens themselves; see NewCachedTokenProvider.
+type TokenProvider interface {
+	Token(context.Context) (string, error)
+}
+
+// StaticToken is a TokenProvider that always returns the same token.
+type StaticToken string
+
+// Token returns the static token.
+func (s StaticToken) Token(context.Context) (string, error) {
+	return string(s), nil
+}
+
+// TokenFunc fetches a new token and reports when it expires. A zero expiry means the token never expires.
+type TokenFunc func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// CachedTokenProvider is a TokenProvider that caches the token returned by a TokenFunc until shortly before it expires.
+// A CachedTokenProvider is safe for concurrent use.
+type CachedTokenProvider struct {
+	fetch TokenFunc
+	skew  time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewCachedTokenProvider returns a CachedTokenProvider that refreshes the token using fetch
+// once it is within skew of expiring.
+func NewCachedTokenProvider(fetch TokenFunc, skew time.Duration) *CachedTokenProvider {
+	return &CachedTokenProvider{fetch: fetch, skew: skew}
+}
+
+// Token returns the cached token, refreshing it first if it has expired.
+func (c *CachedTokenProvider) Token(ctx context.Context) (string, error) {
+	if c == nil {
+		return "", ErrEmptyObject
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Add(c.skew).Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	token, expiry, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if token == "" {
+		return "", errors.New("empty token")
+	}
+
+	c.token = token
+	c.expiry = expiry
+
+	return token, nil
+}
+
+// Invalidate discards the cached token, forcing the next call to Token to refresh it.
+func (c *CachedTokenProvider) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.token = ""
+	c.expiry = time.Time{}
+	c.mu.Unlock()
+}
+
+// ClientCredentials configures an OAuth2 client credentials grant (RFC 6749 section 4.4).
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// EndpointParams are sent as additional form values with the token request, e.g. audience.
+	EndpointParams url.Values
+
+	// Client is used to request tokens. Defaults to an http.Client with a 30 second timeout.
+	Client *http.Client
+}
+
+// NewClientCredentialsProvider returns a TokenProvider that obtains and refreshes tokens using the OAuth2
+// client credentials grant. Tokens are refreshed one minute before they expire.
+func NewClientCredentialsProvider(cc ClientCredentials) *CachedTokenProvider {
+	if cc.Client == nil {
+		cc.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return NewCachedTokenProvider(cc.fetch, time.Minute)
+}
+
+func (cc ClientCredentials) fetch(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{}
+	for k, v := range cc.EndpointParams {
+		form[k] = append([]string(nil), v...)
+	}
+
+	form.Set("grant_type", "client_credentials")
+	if len(cc.Scopes) > 0 {
+		form.Set("scope", strings.Join(cc.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cc.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.SetBasicAuth(url.QueryEscape(cc.ClientID), url.QueryEscape(cc.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := cc.Client.Do(req)
+	if err != nil {
+		return "", time.Time{}, contextError(ctx, err)
+	}
+
+	defer res.Body.Close()
+
+	b, err := readResponse(res, MaxResponseSize)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("godb.ClientCredentials: invalid status code %d (%s): %s", res.StatusCode, res.Status, b)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err := gojson.Unmarshal(b, &tok); err != nil {
+		return "", time.Time{}, err
+	}
+
+	var expiry time.Time
+	if tok.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+
+	return tok.AccessToken, expiry, nil
+}
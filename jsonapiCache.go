@@ -0,0 +1,314 @@
+package godb
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithCache caches GET responses made by the JSONApi in c. A ResponseCache may be shared between JSONApis.
+func WithCache(c *ResponseCache) JSONApiOption {
+	return func(j *JSONApi) {
+		j.cache = c
+	}
+}
+
+// ResponseCacheConfig configures a ResponseCache. Zero values are replaced by the defaults noted on each field.
+type ResponseCacheConfig struct {
+	// MaxEntries is the maximum number of responses held. Default 1000.
+	MaxEntries int
+
+	// MaxBytes is the maximum total size of the response bodies held. Default 64MiB.
+	MaxBytes int64
+
+	// TTL overrides the freshness lifetime for requests whose unexpanded path (without query string) matches the key,
+	// e.g. "/users/{id}" for FetchRequest or "/users/%d" for Fetch. Overrides take precedence over Cache-Control.
+	TTL map[string]time.Duration
+}
+
+// ResponseCacheStats are the counters kept by a ResponseCache.
+type ResponseCacheStats struct {
+	// Hits counts responses served from the cache without contacting the API.
+	Hits int64
+	// Revalidations counts stale responses the API confirmed with 304 Not Modified.
+	Revalidations int64
+	// Misses counts requests that had to be fetched in full.
+	Misses int64
+	// Evictions counts responses removed to stay within the size limits.
+	Evictions int64
+
+	Entries int
+	Bytes   int64
+}
+
+// ResponseCache is an in-memory LRU cache of JSONApi GET responses that follows HTTP shared cache semantics:
+// Cache-Control max-age, s-maxage, no-cache, no-store and private, Expires, Vary, and ETag/Last-Modified revalidation.
+// Responses to requests carrying an Authorization header are only cached when marked public or s-maxage.
+// A ResponseCache is safe for concurrent use.
+type ResponseCache struct {
+	cfg ResponseCacheConfig
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int64
+
+	hits          int64
+	revalidations int64
+	misses        int64
+	evictions     int64
+}
+
+type cacheEntry struct {
+	key     string
+	result  APIResult
+	expires time.Time
+	vary    http.Header
+}
+
+// NewResponseCache returns an empty ResponseCache using the given configuration.
+func NewResponseCache(cfg ResponseCacheConfig) *ResponseCache {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 1000
+	}
+
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 64 << 20
+	}
+
+	return &ResponseCache{
+		cfg:     cfg,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Stats returns the current cache counters.
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	if c == nil {
+		return ResponseCacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ResponseCacheStats{
+		Hits:          atomic.LoadInt64(&c.hits),
+		Revalidations: atomic.LoadInt64(&c.revalidations),
+		Misses:        atomic.LoadInt64(&c.misses),
+		Evictions:     atomic.LoadInt64(&c.evictions),
+		Entries:       c.lru.Len(),
+		Bytes:         c.bytes,
+	}
+}
+
+// Purge removes every response from the cache.
+func (c *ResponseCache) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.bytes = 0
+	c.mu.Unlock()
+}
+
+// lookup returns the cached entry for req, if any, and whether it is still fresh.
+// Stale entries with validators have the conditional request headers added to req.
+func (c *ResponseCache) lookup(req *http.Request) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[req.URL.String()]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	for k, v := range e.vary {
+		if strings.Join(req.Header.Values(k), ",") != strings.Join(v, ",") {
+			return nil, false
+		}
+	}
+
+	c.lru.MoveToFront(el)
+
+	if time.Now().Before(e.expires) {
+		atomic.AddInt64(&c.hits, 1)
+		return e, true
+	}
+
+	if etag := e.result.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	if lm := e.result.Header.Get("Last-Modified"); lm != "" {
+		req.Header.Set("If-Modified-Since", lm)
+	}
+
+	return e, false
+}
+
+// refresh extends a stale entry after the API responded 304 Not Modified.
+func (c *ResponseCache) refresh(e *cacheEntry, label string, h http.Header) {
+	atomic.AddInt64(&c.revalidations, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, v := range h {
+		e.result.Header[k] = v
+	}
+
+	if ttl, ok := c.ttl(label, e.result.Header); ok {
+		e.expires = time.Now().Add(ttl)
+	}
+}
+
+// miss counts a request that had to be fetched in full.
+func (c *ResponseCache) miss() {
+	atomic.AddInt64(&c.misses, 1)
+}
+
+// result returns a copy of the cached response that is safe to hand to callers.
+func (c *ResponseCache) result(e *cacheEntry) *APIResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &APIResult{
+		StatusCode: e.result.StatusCode,
+		Header:     e.result.Header.Clone(),
+		Body:       append([]byte(nil), e.result.Body...),
+	}
+}
+
+// store caches a successful response to req if its headers allow it.
+func (c *ResponseCache) store(req *http.Request, label string, res *APIResult) {
+	ttl, ok := c.ttl(label, res.Header)
+	if !ok {
+		return
+	}
+
+	// A ResponseCache may be shared, so it must not keep responses meant for a single user (RFC 9111 section 3).
+	cc := parseCacheControl(res.Header.Get("Cache-Control"))
+	if _, private := cc["private"]; private {
+		return
+	}
+
+	if req.Header.Get("Authorization") != "" {
+		_, public := cc["public"]
+		_, shared := cc["s-maxage"]
+		if !public && !shared {
+			return
+		}
+	}
+
+	// A response that can neither be served fresh nor revalidated is not worth keeping.
+	if ttl <= 0 && res.Header.Get("ETag") == "" && res.Header.Get("Last-Modified") == "" {
+		return
+	}
+
+	size := int64(len(res.Body))
+	if size > c.cfg.MaxBytes {
+		return
+	}
+
+	vary := http.Header{}
+	for _, v := range res.Header.Values("Vary") {
+		for _, k := range strings.Split(v, ",") {
+			k = strings.TrimSpace(k)
+			if k == "*" {
+				return
+			}
+			if k != "" {
+				vary[http.CanonicalHeaderKey(k)] = req.Header.Values(k)
+			}
+		}
+	}
+
+	e := &cacheEntry{
+		key:     req.URL.String(),
+		result:  APIResult{StatusCode: res.StatusCode, Header: res.Header.Clone(), Body: append([]byte(nil), res.Body...)},
+		expires: time.Now().Add(ttl),
+		vary:    vary,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.bytes += size
+
+	for c.lru.Len() > c.cfg.MaxEntries || c.bytes > c.cfg.MaxBytes {
+		c.remove(c.lru.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+}
+
+// remove must be called with c.mu held.
+func (c *ResponseCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.bytes -= int64(len(e.result.Body))
+}
+
+// ttl returns the freshness lifetime of a response, and false if it must not be stored at all.
+func (c *ResponseCache) ttl(label string, h http.Header) (time.Duration, bool) {
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	if _, ok := cc["no-store"]; ok {
+		return 0, false
+	}
+
+	if ttl, ok := c.cfg.TTL[stripQueryRE.FindString(label)]; ok {
+		return ttl, true
+	}
+
+	if _, ok := cc["no-cache"]; ok {
+		return 0, true
+	}
+
+	v, ok := cc["s-maxage"]
+	if !ok {
+		v, ok = cc["max-age"]
+	}
+
+	if ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			if age, err := strconv.Atoi(h.Get("Age")); err == nil {
+				n -= age
+			}
+			return time.Duration(n) * time.Second, true
+		}
+	}
+
+	if exp, err := http.ParseTime(h.Get("Expires")); err == nil {
+		return time.Until(exp), true
+	}
+
+	return 0, true
+}
+
+func parseCacheControl(v string) map[string]string {
+	cc := map[string]string{}
+	for _, d := range strings.Split(v, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+
+		k, val, _ := strings.Cut(d, "=")
+		cc[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+
+	return cc
+}
@@ -0,0 +1,98 @@
+package godb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type userKey struct{}
+
+// newAuthServer echoes the bearer token of each request back to the caller, with the given Cache-Control header.
+func newAuthServer(t *testing.T, cacheControl string) (*httptest.Server, *int64) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write([]byte(`{"user":"` + strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &hits
+}
+
+func newAuthJSONApi(url string, cache *ResponseCache) *JSONApi {
+	return NewJSONApi(url, "/", time.Second, WithCache(cache), WithHeaderFunc(func(ctx context.Context, h http.Header) error {
+		h.Set("Authorization", "Bearer "+ctx.Value(userKey{}).(string))
+		return nil
+	}))
+}
+
+func fetchUser(t *testing.T, j *JSONApi, user string) string {
+	var res struct {
+		User string `json:"user"`
+	}
+
+	ctx := context.WithValue(context.Background(), userKey{}, user)
+	assert.NoError(t, j.Fetch(ctx, "/me", &res))
+
+	return res.User
+}
+
+func TestResponseCacheAuthorization(t *testing.T) {
+	cases := []struct {
+		name         string
+		cacheControl string
+		shared       bool
+	}{
+		{name: "max-age", cacheControl: "max-age=60"},
+		{name: "private", cacheControl: "private, max-age=60"},
+		{name: "public", cacheControl: "public, max-age=60", shared: true},
+		{name: "s-maxage", cacheControl: "s-maxage=60", shared: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, hits := newAuthServer(t, tc.cacheControl)
+			cache := NewResponseCache(ResponseCacheConfig{})
+			j := newAuthJSONApi(srv.URL, cache)
+
+			assert.Equal(t, "alice", fetchUser(t, j, "alice"))
+
+			if tc.shared {
+				assert.Equal(t, "alice", fetchUser(t, j, "bob"))
+				assert.Equal(t, int64(1), atomic.LoadInt64(hits))
+				return
+			}
+
+			assert.Equal(t, "bob", fetchUser(t, j, "bob"))
+			assert.Equal(t, int64(2), atomic.LoadInt64(hits))
+			assert.Equal(t, 0, cache.Stats().Entries)
+		})
+	}
+}
+
+func TestResponseCachePrivateWithoutAuthorization(t *testing.T) {
+	var hits int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	j := NewJSONApi(srv.URL, "/", time.Second, WithCache(NewResponseCache(ResponseCacheConfig{})))
+
+	var res interface{}
+	assert.NoError(t, j.Fetch(context.Background(), "/me", &res))
+	assert.NoError(t, j.Fetch(context.Background(), "/me", &res))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&hits))
+}
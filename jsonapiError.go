@@ -0,0 +1,96 @@
+package godb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// maxErrorBodySize limits how much of an error response body is kept on an APIError.
+const maxErrorBodySize = 64 << 10
+
+// APIError is returned by JSONApi for any response with a 4xx or 5xx status.
+// Use errors.As to inspect it. errors.Is reports 404, 409 and 422 responses as ErrNotFound, ErrConflict
+// and ErrUnprocessableEntity.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+
+	// Body holds up to the first 64KiB of the decoded response body.
+	Body []byte
+
+	// Problem is the decoded application/problem+json document (RFC 7807), if the response contained one.
+	Problem *ProblemDetails
+}
+
+// ProblemDetails is an RFC 7807 problem details document.
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Extensions holds every member of the document, including any API specific members.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func newAPIError(res *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Header:     res.Header,
+	}
+
+	body, closeBody, err := decodeBody(res.Body, res.Header.Values("Content-Encoding"))
+	if err != nil {
+		return e
+	}
+
+	defer closeBody()
+
+	e.Body, _ = ioutil.ReadAll(io.LimitReader(body, maxErrorBodySize))
+
+	if mt, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil && mt == "application/problem+json" {
+		var p ProblemDetails
+		if json.Unmarshal(e.Body, &p) == nil && json.Unmarshal(e.Body, &p.Extensions) == nil {
+			e.Problem = &p
+		}
+	}
+
+	return e
+}
+
+// Error includes the problem details title and detail when present, otherwise the start of the response body.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("godb.JSONApi: invalid status code %d (%s)", e.StatusCode, e.Status)
+
+	switch {
+	case e.Problem != nil && e.Problem.Detail != "":
+		return fmt.Sprintf("%s: %s: %s", msg, e.Problem.Title, e.Problem.Detail)
+	case e.Problem != nil && e.Problem.Title != "":
+		return fmt.Sprintf("%s: %s", msg, e.Problem.Title)
+	case len(e.Body) > 0:
+		return fmt.Sprintf("%s: %s", msg, truncate(e.Body, 200))
+	}
+
+	return msg
+}
+
+// Is allows errors.Is(err, ErrNotFound) and friends to keep working for the matching status codes.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnprocessableEntity:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	}
+
+	return false
+}
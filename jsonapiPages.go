@@ -0,0 +1,328 @@
+package godb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/btm6084/gojson"
+	"github.com/btm6084/utilities/metrics"
+)
+
+var (
+	// ErrTooManyPages is returned when a paged fetch would exceed PageConfig.MaxPages.
+	ErrTooManyPages = errors.New("godb too many pages")
+)
+
+// PageConfig describes how a paged JSON API links one page of results to the next.
+// The next page is found using CursorPath if it is set, otherwise PageParam if it is set,
+// otherwise the RFC 5988 Link header with rel="next".
+type PageConfig struct {
+	// ItemsPath is the dot separated path to the array of results in each page, e.g. "data".
+	// An empty ItemsPath means each page is itself an array.
+	ItemsPath string
+
+	// CursorPath is the dot separated path to the next page cursor in each page, e.g. "meta.next_cursor".
+	// Paging stops when the cursor is missing, null or empty.
+	CursorPath string
+
+	// CursorParam is the query string parameter the cursor is sent in. Default "cursor".
+	CursorParam string
+
+	// PageParam is the query string parameter holding the page number, e.g. "page".
+	// Paging stops at the first page with no results.
+	PageParam string
+
+	// FirstPage is the number of the first page when using PageParam. Default 1.
+	FirstPage int
+
+	// MaxPages guards against APIs that never stop paging. Default 100.
+	MaxPages int
+}
+
+// FetchAllPages fetches every page of results for req and fills your container with all of the results as a single array.
+func (j *JSONApi) FetchAllPages(ctx context.Context, req APIRequest, cfg PageConfig, container interface{}) error {
+	if j == nil {
+		return ErrEmptyObject
+	}
+
+	return j.FetchAllPagesWithMetrics(ctx, &metrics.NoOp{}, req, cfg, container)
+}
+
+// FetchAllPagesWithMetrics fetches every page of results for req and fills your container with all of the results as a single array.
+func (j *JSONApi) FetchAllPagesWithMetrics(ctx context.Context, r metrics.Recorder, req APIRequest, cfg PageConfig, container interface{}) error {
+	if j == nil {
+		return ErrEmptyObject
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+
+	first := true
+	err := j.EachPageWithMetrics(ctx, r, req, cfg, func(items []byte) error {
+		var list []json.RawMessage
+		if err := json.Unmarshal(items, &list); err != nil {
+			return err
+		}
+
+		for _, item := range list {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			buf.Write(item)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte(']')
+
+	return gojson.Unmarshal(buf.Bytes(), &container)
+}
+
+// EachPage fetches every page of results for req, calling fn with the JSON array of results from each page as it arrives.
+// Returning an error from fn stops paging and returns that error.
+func (j *JSONApi) EachPage(ctx context.Context, req APIRequest, cfg PageConfig, fn func(items []byte) error) error {
+	if j == nil {
+		return ErrEmptyObject
+	}
+
+	return j.EachPageWithMetrics(ctx, &metrics.NoOp{}, req, cfg, fn)
+}
+
+// EachPageWithMetrics fetches every page of results for req, calling fn with the JSON array of results from each page as it arrives.
+// Returning an error from fn stops paging and returns that error.
+func (j *JSONApi) EachPageWithMetrics(ctx context.Context, r metrics.Recorder, req APIRequest, cfg PageConfig, fn func(items []byte) error) error {
+	if j == nil {
+		return ErrEmptyObject
+	}
+
+	if cfg.CursorParam == "" {
+		cfg.CursorParam = "cursor"
+	}
+
+	if cfg.FirstPage == 0 {
+		cfg.FirstPage = 1
+	}
+
+	if cfg.MaxPages <= 0 {
+		cfg.MaxPages = 100
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	body, err := encodeBody(req.Body)
+	if err != nil {
+		return err
+	}
+
+	path, err := req.url()
+	if err != nil {
+		return err
+	}
+
+	page := cfg.FirstPage
+	if cfg.CursorPath == "" && cfg.PageParam != "" {
+		path = setQueryParam(path, cfg.PageParam, strconv.Itoa(page))
+	}
+
+	for n := 0; ; n++ {
+		if n >= cfg.MaxPages {
+			return fmt.Errorf("%w: more than %d pages", ErrTooManyPages, cfg.MaxPages)
+		}
+
+		res, err := j.do(ctx, r, method, req.Path, path, body, req.Args)
+		if err != nil {
+			return err
+		}
+
+		items, err := jsonPath(res.Body, cfg.ItemsPath)
+		if err != nil {
+			return err
+		}
+
+		empty := isEmptyJSONArray(items)
+		if !empty {
+			if err := fn(items); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case cfg.CursorPath != "":
+			// A missing cursor means there are no more pages.
+			raw, err := jsonPath(res.Body, cfg.CursorPath)
+			if err != nil {
+				return nil
+			}
+
+			cursor := string(bytes.TrimSpace(raw))
+			if s, err := strconv.Unquote(cursor); err == nil {
+				cursor = s
+			}
+
+			if cursor == "" || cursor == "null" {
+				return nil
+			}
+
+			path = setQueryParam(path, cfg.CursorParam, cursor)
+
+		case cfg.PageParam != "":
+			if empty {
+				return nil
+			}
+
+			page++
+			path = setQueryParam(path, cfg.PageParam, strconv.Itoa(page))
+
+		default:
+			next := linkNext(res.Header)
+			if next == "" {
+				return nil
+			}
+
+			path, err = j.relativePath(path, next)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// jsonPath returns the raw JSON found at the dot separated path in b.
+func jsonPath(b []byte, path string) ([]byte, error) {
+	if path == "" {
+		return b, nil
+	}
+
+	raw := json.RawMessage(b)
+	for _, key := range strings.Split(path, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("godb: %q is not an object: %w", key, err)
+		}
+
+		v, ok := obj[key]
+		if !ok {
+			return nil, fmt.Errorf("godb: no value at %q", path)
+		}
+
+		raw = v
+	}
+
+	return raw, nil
+}
+
+func isEmptyJSONArray(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) == 0 || bytes.Equal(b, []byte("null")) || bytes.Equal(bytes.Join(bytes.Fields(b), nil), []byte("[]"))
+}
+
+// setQueryParam sets key=value in the query string of path, replacing any existing value.
+func setQueryParam(path, key, value string) string {
+	base, query, _ := strings.Cut(path, "?")
+
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		q = url.Values{}
+	}
+
+	q.Set(key, value)
+
+	return base + "?" + q.Encode()
+}
+
+// linkNext returns the target of the rel="next" link in an RFC 5988 Link header.
+func linkNext(h http.Header) string {
+	for _, header := range h.Values("Link") {
+		for _, link := range splitLink(header, ',') {
+			parts := splitLink(link, ';')
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, p := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(v, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// splitLink splits a Link header on sep, ignoring any sep inside a <URI> or a quoted string,
+// as both may legitimately contain commas and semicolons.
+func splitLink(s string, sep byte) []string {
+	var (
+		parts   []string
+		start   int
+		inURI   bool
+		inQuote bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case inURI:
+			inURI = c != '>'
+		case c == '<':
+			inURI = true
+		case c == '"':
+			inQuote = true
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// relativePath resolves a link against the current request and returns it relative to baseURL.
+// Links that leave the baseURL are refused so that credentials are never sent to another host.
+func (j *JSONApi) relativePath(current, link string) (string, error) {
+	cur, err := url.Parse(j.requestURL(current))
+	if err != nil {
+		return "", err
+	}
+
+	next, err := cur.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	href := next.String()
+	if !strings.HasPrefix(href, j.baseURL+"/") {
+		return "", fmt.Errorf("godb.JSONApi: next link %q is outside of %s", href, j.baseURL)
+	}
+
+	return strings.TrimPrefix(href, j.baseURL), nil
+}
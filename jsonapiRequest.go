@@ -0,0 +1,172 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/btm6084/gojson"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/spf13/cast"
+)
+
+// APIRequest describes a JSONApi request with a templated path.
+// Unlike the requestURI accepted by Fetch, every value is escaped before it is added to the URL.
+type APIRequest struct {
+	// Method defaults to GET.
+	Method string
+
+	// Path is relative to the JSONApi baseURL and may contain placeholders, e.g. "/users/{id}/orders".
+	// Path is reported to metrics unexpanded.
+	Path string
+
+	// Params fills placeholders by name. Placeholders not found in Params are filled from Args, in order.
+	Params map[string]interface{}
+	Args   []interface{}
+
+	// Query is encoded and appended to the expanded Path.
+	Query url.Values
+
+	// Body is encoded as JSON and sent with the request, unless it is nil.
+	Body interface{}
+}
+
+// ExpandPath replaces each {name} placeholder in template with the escaped value of params[name],
+// or if there is no such param, with the next value from args. Placeholders in the path are path escaped,
+// and may not be "." or "..". Placeholders after a ? are query escaped.
+func ExpandPath(template string, params map[string]interface{}, args ...interface{}) (string, error) {
+	var b strings.Builder
+	next := 0
+	inQuery := false
+
+	for {
+		open := strings.IndexByte(template, '{')
+		if open < 0 {
+			b.WriteString(template)
+			break
+		}
+
+		end := strings.IndexByte(template[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("godb.ExpandPath: unterminated placeholder in %q", template)
+		}
+		end += open
+
+		name := template[open+1 : end]
+
+		v, ok := params[name]
+		if !ok {
+			if next >= len(args) {
+				return "", fmt.Errorf("godb.ExpandPath: no value for placeholder {%s}", name)
+			}
+
+			v = args[next]
+			next++
+		}
+
+		s, err := cast.ToStringE(v)
+		if err != nil {
+			return "", fmt.Errorf("godb.ExpandPath: placeholder {%s}: %w", name, err)
+		}
+
+		b.WriteString(template[:open])
+		if !inQuery && strings.Contains(template[:open], "?") {
+			inQuery = true
+		}
+
+		// Values after the ? must not be able to add parameters, and path segments must not be able to climb the path.
+		if inQuery {
+			b.WriteString(url.QueryEscape(s))
+		} else {
+			if s == "." || s == ".." {
+				return "", fmt.Errorf("godb.ExpandPath: placeholder {%s}: %q is not a valid path segment", name, s)
+			}
+			b.WriteString(url.PathEscape(s))
+		}
+
+		template = template[end+1:]
+	}
+
+	if next < len(args) {
+		return "", fmt.Errorf("godb.ExpandPath: %d unused args", len(args)-next)
+	}
+
+	return b.String(), nil
+}
+
+// url returns the expanded path and query string of the request.
+func (a APIRequest) url() (string, error) {
+	path, err := ExpandPath(a.Path, a.Params, a.Args...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(a.Query) == 0 {
+		return path, nil
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return path + sep + a.Query.Encode(), nil
+}
+
+// Do sends the request and returns the response.
+func (j *JSONApi) Do(ctx context.Context, req APIRequest) (*APIResult, error) {
+	if j == nil {
+		return nil, ErrEmptyObject
+	}
+
+	return j.DoWithMetrics(ctx, &metrics.NoOp{}, req)
+}
+
+// DoWithMetrics sends the request and returns the response.
+func (j *JSONApi) DoWithMetrics(ctx context.Context, r metrics.Recorder, req APIRequest) (*APIResult, error) {
+	if j == nil {
+		return nil, ErrEmptyObject
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	path, err := req.url()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := encodeBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return j.do(ctx, r, method, req.Path, path, body, req.Args)
+}
+
+// FetchRequest sends the request and fills your container with the response.
+func (j *JSONApi) FetchRequest(ctx context.Context, req APIRequest, container interface{}) error {
+	if j == nil {
+		return ErrEmptyObject
+	}
+
+	return j.FetchRequestWithMetrics(ctx, &metrics.NoOp{}, req, container)
+}
+
+// FetchRequestWithMetrics sends the request and fills your container with the response.
+func (j *JSONApi) FetchRequestWithMetrics(ctx context.Context, r metrics.Recorder, req APIRequest, container interface{}) error {
+	if j == nil {
+		return ErrEmptyObject
+	}
+
+	res, err := j.DoWithMetrics(ctx, r, req)
+	if err != nil {
+		return err
+	}
+
+	return gojson.Unmarshal(res.Body, &container)
+}
@@ -0,0 +1,229 @@
+package godb
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures how a JSONApi retries failed requests. Zero values are replaced by the defaults noted on each field.
+// GET and HEAD requests are always eligible for retry. Other methods are only retried when the context
+// has been marked with WithIdempotent, so that a POST is never repeated unless the caller knows it is safe.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Default 3.
+	MaxAttempts int
+
+	// MinBackoff is the base delay before the first retry; each retry doubles it, with full jitter. Default 100ms.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts, including delays requested by Retry-After. Default 10s.
+	MaxBackoff time.Duration
+
+	// RetryStatuses are the response status codes that are retried. Default 429, 502, 503 and 504.
+	RetryStatuses []int
+}
+
+// WithRetry retries failed requests made by the JSONApi according to p.
+// Requests are retried on network errors and on the configured statuses, honoring any Retry-After header.
+func WithRetry(p RetryPolicy) JSONApiOption {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = 100 * time.Millisecond
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 10 * time.Second
+	}
+
+	if len(p.RetryStatuses) == 0 {
+		p.RetryStatuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+
+	return func(j *JSONApi) {
+		j.retry = &p
+	}
+}
+
+// WithRateLimit limits the JSONApi to an average of rps requests per second, allowing bursts of up to burst requests.
+// Requests wait for capacity, or until their context is done.
+func WithRateLimit(rps float64, burst int) JSONApiOption {
+	return func(j *JSONApi) {
+		j.limiter = newTokenBucket(rps, burst)
+	}
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks requests made with the returned context as safe to retry, whatever their method.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func (p *RetryPolicy) canRetry(ctx context.Context, method string) bool {
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+
+	ok, _ := ctx.Value(idempotentKey{}).(bool)
+	return ok
+}
+
+func (p *RetryPolicy) retryStatus(code int) bool {
+	for _, s := range p.RetryStatuses {
+		if s == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the delay before the given retry attempt (1 for the first retry).
+func (p *RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if d, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			if d > p.MaxBackoff {
+				return p.MaxBackoff
+			}
+			return d
+		}
+	}
+
+	d := p.MinBackoff << uint(attempt-1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryAfter parses a Retry-After header given in either delay-seconds or HTTP-date form.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// roundTrip sends req, waiting on the rate limiter and retrying according to the retry policy.
+func (j *JSONApi) roundTrip(ctx context.Context, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if j.limiter != nil {
+			if err := j.limiter.wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := j.client.Do(req)
+
+		if j.retry == nil || attempt >= j.retry.MaxAttempts || ctx.Err() != nil || !j.retry.canRetry(ctx, req.Method) {
+			return res, err
+		}
+
+		if err == nil && !j.retry.retryStatus(res.StatusCode) {
+			return res, nil
+		}
+
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+
+		delay := j.retry.backoff(attempt, res)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+
+		req = req.Clone(ctx)
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// tokenBucket is a minimal token bucket rate limiter.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rps float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+
+		var delay time.Duration
+		if b.rate > 0 {
+			delay = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		} else {
+			delay = time.Second
+		}
+		b.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package godb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WithRoundTripper replaces the JSONApi transport with rt, e.g. an instrumented transport or the Client().Transport
+// of an httptest.Server. The other transport options have no effect when a RoundTripper is supplied.
+func WithRoundTripper(rt http.RoundTripper) JSONApiOption {
+	return func(j *JSONApi) {
+		j.roundTripper = rt
+	}
+}
+
+// WithTLSConfig replaces the TLS configuration used by the JSONApi transport with a copy of c.
+// Certificates and root CAs set by earlier WithClientCertificate and WithRootCAs options are kept,
+// unless c sets its own RootCAs. Options applied after WithTLSConfig modify the copy.
+func WithTLSConfig(c *tls.Config) JSONApiOption {
+	return func(j *JSONApi) {
+		cfg := c.Clone()
+
+		if prev := j.transport.TLSClientConfig; prev != nil {
+			if cfg.RootCAs == nil {
+				cfg.RootCAs = prev.RootCAs
+			}
+			cfg.Certificates = append(append([]tls.Certificate(nil), prev.Certificates...), cfg.Certificates...)
+		}
+
+		j.transport.TLSClientConfig = cfg
+	}
+}
+
+// WithRootCAs verifies the API's certificate against pool instead of the system roots.
+func WithRootCAs(pool *x509.CertPool) JSONApiOption {
+	return func(j *JSONApi) {
+		tlsConfig(j).RootCAs = pool
+	}
+}
+
+// WithClientCertificate presents cert to the API for mutual TLS.
+// Use tls.LoadX509KeyPair or tls.X509KeyPair to load the certificate and key.
+func WithClientCertificate(cert tls.Certificate) JSONApiOption {
+	return func(j *JSONApi) {
+		c := tlsConfig(j)
+		c.Certificates = append(c.Certificates, cert)
+	}
+}
+
+// WithProxy sets the proxy used by the JSONApi transport, e.g. http.ProxyURL(u).
+// The default is http.ProxyFromEnvironment. A nil proxy disables proxying.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) JSONApiOption {
+	return func(j *JSONApi) {
+		j.transport.Proxy = proxy
+	}
+}
+
+// WithConnectionLimits sets the connection pool sizes of the JSONApi transport. Each defaults to 100.
+// A value of zero means no limit, as for http.Transport.
+func WithConnectionLimits(maxIdle, maxIdlePerHost, maxPerHost int) JSONApiOption {
+	return func(j *JSONApi) {
+		j.transport.MaxIdleConns = maxIdle
+		j.transport.MaxIdleConnsPerHost = maxIdlePerHost
+		j.transport.MaxConnsPerHost = maxPerHost
+	}
+}
+
+// WithKeepAlive enables or disables HTTP keep-alives on the JSONApi transport, and sets how long idle connections are kept.
+// An idleTimeout of zero leaves the default of 90 seconds.
+func WithKeepAlive(enabled bool, idleTimeout time.Duration) JSONApiOption {
+	return func(j *JSONApi) {
+		j.transport.DisableKeepAlives = !enabled
+		if idleTimeout > 0 {
+			j.transport.IdleConnTimeout = idleTimeout
+		}
+	}
+}
+
+// tlsConfig returns the TLS configuration of the JSONApi transport, creating it if needed.
+func tlsConfig(j *JSONApi) *tls.Config {
+	if j.transport.TLSClientConfig == nil {
+		j.transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return j.transport.TLSClientConfig
+}
@@ -0,0 +1,209 @@
+package godb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Interceptor = (*LoggingInterceptor)(nil)
+
+// LogLevel is the severity of a query log record.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// String returns the lower case name of the level.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// QueryLogger receives structured query log records.
+type QueryLogger interface {
+	Log(ctx context.Context, level LogLevel, msg string, fields map[string]interface{})
+}
+
+// QueryLoggerFunc adapts a function to the QueryLogger interface.
+type QueryLoggerFunc func(ctx context.Context, level LogLevel, msg string, fields map[string]interface{})
+
+// Log calls f.
+func (f QueryLoggerFunc) Log(ctx context.Context, level LogLevel, msg string, fields map[string]interface{}) {
+	f(ctx, level, msg, fields)
+}
+
+// NewLogrusQueryLogger returns a QueryLogger that writes to the given logrus logger or entry.
+func NewLogrusQueryLogger(l log.FieldLogger) QueryLogger {
+	return QueryLoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields map[string]interface{}) {
+		entry := l.WithFields(log.Fields(fields))
+
+		switch level {
+		case LogLevelDebug:
+			entry.Debug(msg)
+		case LogLevelInfo:
+			entry.Info(msg)
+		case LogLevelWarn:
+			entry.Warn(msg)
+		default:
+			entry.Error(msg)
+		}
+	})
+}
+
+// ArgRedactor returns the value to log in place of the i'th argument to query.
+type ArgRedactor func(query string, i int, arg interface{}) interface{}
+
+// Redacted is logged in place of any argument removed by an ArgRedactor.
+const Redacted = "[REDACTED]"
+
+// RedactArgsMatching redacts any string or []byte argument matching re, e.g. email addresses or card numbers.
+func RedactArgsMatching(re *regexp.Regexp) ArgRedactor {
+	return func(query string, i int, arg interface{}) interface{} {
+		switch v := arg.(type) {
+		case string:
+			if re.MatchString(v) {
+				return Redacted
+			}
+		case []byte:
+			if re.Match(v) {
+				return Redacted
+			}
+		}
+
+		return arg
+	}
+}
+
+// RedactQueriesMatching redacts every argument of any query matching re, e.g. `(?i)password`.
+func RedactQueriesMatching(re *regexp.Regexp) ArgRedactor {
+	return func(query string, i int, arg interface{}) interface{} {
+		if re.MatchString(query) {
+			return Redacted
+		}
+
+		return arg
+	}
+}
+
+// LoggingConfig configures a LoggingInterceptor.
+type LoggingConfig struct {
+	// Logger receives the log records. Defaults to the standard logrus logger.
+	Logger QueryLogger
+
+	// SlowThreshold logs any successful call that takes at least this long at LogLevelWarn. Zero disables slow query logging.
+	SlowThreshold time.Duration
+
+	// SuccessSampleRate is the fraction [0, 1] of other successful calls logged at LogLevelDebug. Zero disables success logging.
+	SuccessSampleRate float64
+
+	// OmitArgs leaves query arguments out of every log record.
+	OmitArgs bool
+
+	// Redactors are applied in order to each argument before it is logged.
+	Redactors []ArgRedactor
+
+	// IsError decides whether a call's error is logged at LogLevelError. Other errors are logged as successful calls.
+	// Defaults to the same exclusions as CircuitBreakerConfig.IsFailure, such as sql.ErrNoRows, ErrNotFound and context.Canceled.
+	IsError func(error) bool
+}
+
+// LoggingInterceptor is an Interceptor that logs failed calls at LogLevelError, slow calls at LogLevelWarn,
+// and a sample of successful calls at LogLevelDebug.
+// Use it with Wrap: godb.Wrap(db, interceptor).
+type LoggingInterceptor struct {
+	cfg LoggingConfig
+}
+
+// NewLoggingInterceptor returns a LoggingInterceptor using the given configuration.
+func NewLoggingInterceptor(cfg LoggingConfig) *LoggingInterceptor {
+	if cfg.Logger == nil {
+		cfg.Logger = NewLogrusQueryLogger(log.StandardLogger())
+	}
+
+	if cfg.IsError == nil {
+		cfg.IsError = isBreakerFailure
+	}
+
+	return &LoggingInterceptor{cfg: cfg}
+}
+
+// Before does nothing; all logging happens once the call has completed.
+func (l *LoggingInterceptor) Before(ctx context.Context, info *QueryInfo) (context.Context, error) {
+	return ctx, nil
+}
+
+// After logs the completed call according to the configuration.
+func (l *LoggingInterceptor) After(ctx context.Context, info *QueryInfo) {
+	var level LogLevel
+	var msg string
+
+	switch {
+	case info.Err != nil && l.cfg.IsError(info.Err):
+		level, msg = LogLevelError, "godb query failed"
+	case l.cfg.SlowThreshold > 0 && info.Duration >= l.cfg.SlowThreshold:
+		level, msg = LogLevelWarn, "godb slow query"
+	case l.cfg.SuccessSampleRate > 0 && rand.Float64() < l.cfg.SuccessSampleRate:
+		level, msg = LogLevelDebug, "godb query"
+	default:
+		return
+	}
+
+	l.cfg.Logger.Log(ctx, level, msg, l.fields(info))
+}
+
+func (l *LoggingInterceptor) fields(info *QueryInfo) map[string]interface{} {
+	fields := map[string]interface{}{
+		"operation":   info.Operation,
+		"duration_ms": float64(info.Duration) / float64(time.Millisecond),
+		"in_tx":       info.InTx,
+	}
+
+	if info.Query != "" {
+		fields["query"] = transformQuery(info.Query)
+	}
+
+	if !l.cfg.OmitArgs && len(info.Args) > 0 {
+		fields["args"] = l.redact(info.Query, info.Args)
+	}
+
+	if info.RowsAffected >= 0 {
+		fields["rows_affected"] = info.RowsAffected
+	}
+
+	if info.Err != nil {
+		fields["error"] = info.Err.Error()
+	}
+
+	return fields
+}
+
+func (l *LoggingInterceptor) redact(query string, args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		for _, r := range l.cfg.Redactors {
+			arg = r(query, i, arg)
+		}
+		out[i] = arg
+	}
+
+	return out
+}
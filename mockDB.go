@@ -3,7 +3,11 @@ package godb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/btm6084/gojson"
@@ -13,9 +17,21 @@ import (
 
 var _ Database = &MockDB{}
 
+var (
+	// ErrMockMismatch is returned by a mock, after failing the test, when it receives a call that does not match its expectations.
+	// Mocks are called from the goroutines of the code under test, where t.FailNow must not be used, so every mock in this
+	// package reports a mismatch with t.Errorf and returns ErrMockMismatch instead of stopping the test.
+	ErrMockMismatch = errors.New("godb mock call mismatch")
+)
+
 // MockDB implements the Database interface and allows for database mocking.
+// MockDB is safe for concurrent use, although the order of concurrent calls is not defined.
 type MockDB struct {
-	t *testing.T
+	t  *testing.T
+	mu sync.Mutex
+
+	MockTxState
+	MockHealthState
 
 	FetchPointer  int
 	FetchExpected []DBResult
@@ -28,58 +44,202 @@ type MockDB struct {
 	ExecPointer  int
 	ExecExpected []DBResult
 	ExecCount    int
+
+	// ids holds the last auto increment ID of each table, when enabled by AutoIncrementIDs.
+	ids map[string]int64
 }
 
 // DBResult allows Exec/Fetch responses to be crafted.
+// Args may contain ArgMatchers, such as Any or WithinDuration, in place of exact values.
 type DBResult struct {
 	Query   string
 	Args    []interface{}
 	Content []byte
 	Error   error
 	Result  SQLResult
+
+	// Tx requires the query to run inside or outside of a transaction. Defaults to TxAny.
+	Tx TxExpectation
+
+	// QueryMatcher decides whether a query satisfies Query. Defaults to QueryEqual for MockDB and QueryNormalized for AsyncMockDB.
+	QueryMatcher QueryMatcher
+
+	// times is the number of uses left in an AsyncMockDB; 0 means once and -1 means any number. See Times.
+	times int
 }
 
 // SQLResult allows Exec responses to be crafted.
 type SQLResult struct {
 	Affected    int64
 	AffectedErr error
+
+	InsertID    int64
+	InsertIDErr error
 }
 
 // LastInsertId returns the id of the last inserted row.
-func (r *SQLResult) LastInsertId() (int64, error) { return 0, nil }
+func (r *SQLResult) LastInsertId() (int64, error) { return r.InsertID, r.InsertIDErr }
 
 // RowsAffected returns the number of rows affected by an exec query.
 func (r *SQLResult) RowsAffected() (int64, error) { return r.Affected, r.AffectedErr }
 
+// MockOption configures a MockDB or AsyncMockDB.
+type MockOption func(*mockConfig)
+
+type mockConfig struct {
+	verify        bool
+	autoIncrement bool
+}
+
+// VerifyOnCleanup registers AssertExpectations with t.Cleanup, so the test fails if any expectation is unmet when it ends.
+func VerifyOnCleanup() MockOption {
+	return func(c *mockConfig) {
+		c.verify = true
+	}
+}
+
+// AutoIncrementIDs makes Exec calls that INSERT into a table return sequential LastInsertIds, counted per table from 1,
+// unless the expected DBResult sets Result.InsertID or Result.InsertIDErr. As with MySQL, an insert affecting
+// several rows returns the first of the IDs it used.
+func AutoIncrementIDs() MockOption {
+	return func(c *mockConfig) {
+		c.autoIncrement = true
+	}
+}
+
+func newMockConfig(opts []MockOption) mockConfig {
+	var c mockConfig
+	for _, o := range opts {
+		o(&c)
+	}
+
+	return c
+}
+
 // NewMockDB returns a ready to use MockDB struct.
-func NewMockDB(t *testing.T) *MockDB {
-	return &MockDB{t: t}
+func NewMockDB(t *testing.T, opts ...MockOption) *MockDB {
+	db := &MockDB{t: t}
+
+	cfg := newMockConfig(opts)
+	if cfg.verify && t != nil {
+		t.Cleanup(func() { db.AssertExpectations() })
+	}
+
+	if cfg.autoIncrement {
+		db.ids = map[string]int64{}
+	}
+
+	return db
+}
+
+// ExpectationsWereMet returns an error listing every expected Fetch, FetchJSON and Exec that was never called,
+// and any transaction that was neither committed nor rolled back.
+func (db *MockDB) ExpectationsWereMet() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var unmet []string
+	unmet = appendUnmet(unmet, "Fetch", remaining(db.FetchExpected, db.FetchPointer))
+	unmet = appendUnmet(unmet, "FetchJSON", remaining(db.FetchJSONExpected, db.FetchJSONPointer))
+	unmet = appendUnmet(unmet, "Exec", remaining(db.ExecExpected, db.ExecPointer))
+	unmet = db.MockTxState.appendUnmet(unmet)
+
+	return unmetError(unmet)
+}
+
+// AssertExpectations fails the test if any expected Fetch, FetchJSON or Exec was never called.
+func (db *MockDB) AssertExpectations() bool {
+	return assert.NoError(db.t, db.ExpectationsWereMet())
+}
+
+var insertRE = regexp.MustCompile(`(?i)^\s*INSERT\s+(?:(?:LOW_PRIORITY|DELAYED|HIGH_PRIORITY|IGNORE|OR\s+\w+)\s+)*INTO\s+([^\s(]+)`)
+
+// assignInsertID sets the next auto increment ID of the table q inserts into, unless ids is nil,
+// q is not an INSERT, or the result already has an ID or error set.
+func assignInsertID(ids map[string]int64, q string, r *SQLResult) {
+	if ids == nil || r.InsertID != 0 || r.InsertIDErr != nil {
+		return
+	}
+
+	m := insertRE.FindStringSubmatch(q)
+	if m == nil {
+		return
+	}
+
+	table := strings.ToLower(strings.Trim(m[1], "`\"[]"))
+
+	n := r.Affected
+	if n < 1 {
+		n = 1
+	}
+
+	r.InsertID = ids[table] + 1
+	ids[table] += n
+}
+
+func remaining(expected []DBResult, pointer int) []DBResult {
+	if pointer >= len(expected) {
+		return nil
+	}
+
+	return expected[pointer:]
+}
+
+func appendUnmet(unmet []string, op string, expected []DBResult) []string {
+	for _, e := range expected {
+		unmet = append(unmet, fmt.Sprintf("%s: %s %v", op, transformQuery(e.Query), e.Args))
+	}
+
+	return unmet
+}
+
+func unmetError(unmet []string) error {
+	if len(unmet) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("godb: %d unmet expectations:\n\t%s", len(unmet), strings.Join(unmet, "\n\t"))
 }
 
 // AssertNoCalls asserts that there were no Fetch or Exec calls.
 func (db *MockDB) AssertNoCalls() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	assert.Zero(db.t, db.FetchCount, "No Fetches Expected")
 	assert.Zero(db.t, db.ExecCount, "No Execs Expected")
 }
 
 // OnConsecutiveFetch returns the next defined value each time one of the fetch functions is called.
 func (db *MockDB) OnConsecutiveFetch(fc []DBResult) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	db.FetchExpected = fc
 }
 
-// Ping satisfies the Database interface.
+// Ping returns the configured PingError, see MockHealthState.
 func (db *MockDB) Ping(context.Context) error {
-	return nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.ping()
 }
 
-// Shutdown satisfies the Database interface.
+// Shutdown returns the configured ShutdownError.
 func (db *MockDB) Shutdown(context.Context) error {
-	return nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.shutdown()
 }
 
-// Stats satisfies the Database interface.
+// Stats returns the configured DBStats.
 func (db *MockDB) Stats(context.Context) sql.DBStats {
-	return sql.DBStats{}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.stats()
 }
 
 // FetchWithMetrics mocks FetchWithMetrics by simply ignoring the metrics during the unittest.
@@ -90,32 +250,48 @@ func (db *MockDB) FetchWithMetrics(ctx context.Context, r metrics.Recorder, q st
 
 // Fetch allows for mocking the response from a fetch request.
 func (db *MockDB) Fetch(ctx context.Context, q string, c interface{}, args ...interface{}) error {
-	db.FetchCount++
+	return db.fetch(q, c, args, false)
+}
 
-	if !assert.True(db.t, len(db.FetchExpected) > 0, "No FetchExpected Defined") {
-		db.t.FailNow()
+// next returns the next expectation from expected, failing the test and returning ErrMockMismatch if the call does not satisfy it.
+// next must be called with db.mu held.
+func (db *MockDB) next(op string, expected []DBResult, pointer *int, q string, args []interface{}, inTx bool) (DBResult, error) {
+	if len(expected) == 0 {
+		assert.Fail(db.t, fmt.Sprintf("No %sExpected Defined", op), "%s", q)
+		return DBResult{}, ErrMockMismatch
 	}
 
-	// We repeat the final registered Fetch mock if we run out.
-	if db.FetchPointer >= len(db.FetchExpected) {
-		fmt.Print("\nMore Fetch Calls than Expected\n\n")
-		db.t.FailNow()
+	if *pointer >= len(expected) {
+		assert.Fail(db.t, fmt.Sprintf("More %s Calls than Expected", op), "%s", q)
+		return DBResult{}, ErrMockMismatch
 	}
 
-	fetch := db.FetchExpected[db.FetchPointer]
-	db.FetchPointer++
+	r := expected[*pointer]
+	*pointer++
 
-	if !assert.Equal(db.t, fetch.Query, q) {
-		db.t.FailNow()
+	if !assertQuery(db.t, r, q, QueryEqual) || !assertTx(db.t, r, q, inTx) || !assertArgs(db.t, r, args) {
+		return DBResult{}, ErrMockMismatch
 	}
 
-	assertDeepEqual(db.t, fetch.Args, args)
+	return r, nil
+}
+
+func (db *MockDB) fetch(q string, c interface{}, args []interface{}, inTx bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.FetchCount++
+
+	fetch, err := db.next("Fetch", db.FetchExpected, &db.FetchPointer, q, args, inTx)
+	if err != nil {
+		return err
+	}
 
 	if fetch.Error != nil {
 		return fetch.Error
 	}
 
-	err := gojson.Unmarshal(fetch.Content, c)
+	err = gojson.Unmarshal(fetch.Content, c)
 	assert.Nil(db.t, err)
 
 	return nil
@@ -129,32 +305,28 @@ func (db *MockDB) ExecWithMetrics(ctx context.Context, r metrics.Recorder, q str
 
 // Exec allows for mocking the response from an exec request.
 func (db *MockDB) Exec(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
-	db.ExecCount++
-
-	if !assert.True(db.t, len(db.ExecExpected) > 0, "No ExecExpected Defined") {
-		db.t.FailNow()
-	}
+	return db.exec(q, args, false)
+}
 
-	// We repeat the final registered Exec mock if we run out.
-	if db.ExecPointer >= len(db.ExecExpected) {
-		fmt.Print("\nMore Exec Calls than Expected\n\n")
-		db.t.FailNow()
-	}
+func (db *MockDB) exec(q string, args []interface{}, inTx bool) (sql.Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	exec := db.ExecExpected[db.ExecPointer]
-	db.ExecPointer++
+	db.ExecCount++
 
-	if !assert.Equal(db.t, exec.Query, q) {
-		db.t.FailNow()
+	exec, err := db.next("Exec", db.ExecExpected, &db.ExecPointer, q, args, inTx)
+	if err != nil {
+		return nil, err
 	}
 
-	assertDeepEqual(db.t, exec.Args, args)
-
 	if exec.Error != nil {
 		return nil, exec.Error
 	}
 
-	return &exec.Result, nil
+	res := exec.Result
+	assignInsertID(db.ids, q, &res)
+
+	return &res, nil
 }
 
 // FetchJSONWithMetrics mocks FetchJSONWithMetrics by simply ignoring the metrics during the unittest.
@@ -165,27 +337,20 @@ func (db *MockDB) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder,
 
 // FetchJSON allows for mocking the response from a fetch request.
 func (db *MockDB) FetchJSON(ctx context.Context, q string, args ...interface{}) ([]byte, error) {
-	db.FetchJSONCount++
-
-	if !assert.True(db.t, len(db.FetchJSONExpected) > 0, "No FetchJSONExpected Defined") {
-		db.t.FailNow()
-	}
+	return db.fetchJSON(q, args, false)
+}
 
-	// We repeat the final registered FetchJSON mock if we run out.
-	if db.FetchJSONPointer >= len(db.FetchJSONExpected) {
-		fmt.Print("\nMore FetchJSON Calls than Expected\n\n")
-		db.t.FailNow()
-	}
+func (db *MockDB) fetchJSON(q string, args []interface{}, inTx bool) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	fetch := db.FetchJSONExpected[db.FetchJSONPointer]
-	db.FetchJSONPointer++
+	db.FetchJSONCount++
 
-	if !assert.Equal(db.t, fetch.Query, q) {
-		db.t.FailNow()
+	fetch, err := db.next("FetchJSON", db.FetchJSONExpected, &db.FetchJSONPointer, q, args, inTx)
+	if err != nil {
+		return nil, err
 	}
 
-	assertDeepEqual(db.t, fetch.Args, args)
-
 	if fetch.Error != nil {
 		return nil, fetch.Error
 	}
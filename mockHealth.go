@@ -0,0 +1,57 @@
+package godb
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	// ErrMockPing is returned by a mock's Ping while PingFailures remain and no PingError is set.
+	ErrMockPing = errors.New("godb mock ping failure")
+)
+
+// MockHealthState configures the Ping, Stats and Shutdown responses of a MockDB or AsyncMockDB, and counts the calls made to them.
+type MockHealthState struct {
+	// PingError is returned by Ping. When PingFailures is set, only the first PingFailures calls fail,
+	// returning PingError or ErrMockPing, and later calls succeed.
+	PingError    error
+	PingFailures int
+
+	// ShutdownError is returned by Shutdown.
+	ShutdownError error
+
+	// DBStats is returned by Stats.
+	DBStats sql.DBStats
+
+	PingCount     int
+	ShutdownCount int
+	StatsCount    int
+}
+
+func (s *MockHealthState) ping() error {
+	s.PingCount++
+
+	if s.PingFailures <= 0 {
+		return s.PingError
+	}
+
+	if s.PingCount > s.PingFailures {
+		return nil
+	}
+
+	if s.PingError != nil {
+		return s.PingError
+	}
+
+	return ErrMockPing
+}
+
+func (s *MockHealthState) shutdown() error {
+	s.ShutdownCount++
+	return s.ShutdownError
+}
+
+func (s *MockHealthState) stats() sql.DBStats {
+	s.StatsCount++
+	return s.DBStats
+}
@@ -0,0 +1,230 @@
+package godb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockPingPath is answered by every MockAPIServer, so that JSONApi.Ping succeeds without an expectation.
+const mockPingPath = "/_godb/ping"
+
+// MockAPIResponse describes a request a MockAPIServer expects, and the response it serves for it.
+type MockAPIResponse struct {
+	// Method defaults to GET.
+	Method string
+
+	// Path is the expected path and query string, relative to the JSONApi baseURL.
+	// Args are applied with fmt.Sprintf(Path, Args...), as they are by JSONApi.Fetch. Query parameters may be in any order.
+	Path string
+	Args []interface{}
+
+	// RequestBody, when set, must be JSON equal to the body of the request.
+	RequestBody []byte
+
+	// Status defaults to 200.
+	Status int
+	Header http.Header
+
+	// Content is the response body. Content-Type defaults to application/json.
+	Content []byte
+
+	// Gzip compresses Content and sends it with Content-Encoding: gzip.
+	Gzip bool
+
+	// Delay waits before responding, or until the request is cancelled.
+	Delay time.Duration
+}
+
+// MockAPIServer is an httptest server for testing JSONApi consumers.
+// Each request is served by the first unused expectation matching its method and path, in any order.
+// A MockAPIServer is safe for concurrent use.
+type MockAPIServer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	expected  []MockAPIResponse
+	callCount int
+}
+
+// NewMockAPIServer starts a MockAPIServer that is closed when the test ends.
+func NewMockAPIServer(t *testing.T, opts ...MockOption) *MockAPIServer {
+	m := &MockAPIServer{t: t}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	t.Cleanup(m.server.Close)
+
+	if cfg := newMockConfig(opts); cfg.verify {
+		t.Cleanup(func() { m.AssertExpectations() })
+	}
+
+	return m
+}
+
+// URL returns the base URL of the server.
+func (m *MockAPIServer) URL() string {
+	return m.server.URL
+}
+
+// JSONApi returns a JSONApi that sends its requests to the server.
+func (m *MockAPIServer) JSONApi(opts ...JSONApiOption) *JSONApi {
+	return NewJSONApi(m.server.URL, mockPingPath, 10*time.Second, opts...)
+}
+
+// Expect registers responses for requests the server should receive.
+func (m *MockAPIServer) Expect(r ...MockAPIResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expected = append(m.expected, r...)
+}
+
+// CallCount returns the number of requests received, excluding pings.
+func (m *MockAPIServer) CallCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.callCount
+}
+
+// ExpectationsWereMet returns an error listing every expected request that was never received.
+func (m *MockAPIServer) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var unmet []string
+	for _, e := range m.expected {
+		unmet = append(unmet, fmt.Sprintf("%s %s", e.method(), e.path()))
+	}
+
+	return unmetError(unmet)
+}
+
+// AssertExpectations fails the test if any expected request was never received.
+func (m *MockAPIServer) AssertExpectations() bool {
+	return assert.NoError(m.t, m.ExpectationsWereMet())
+}
+
+func (e MockAPIResponse) method() string {
+	if e.Method == "" {
+		return http.MethodGet
+	}
+
+	return strings.ToUpper(e.Method)
+}
+
+// path returns the expected path with Args applied and a leading /, as JSONApi treats "users/1" and "/users/1" alike.
+func (e MockAPIResponse) path() string {
+	p := e.Path
+	if len(e.Args) > 0 {
+		p = fmt.Sprintf(p, e.Args...)
+	}
+
+	return "/" + strings.TrimPrefix(p, "/")
+}
+
+// matches reports whether the request satisfies the expectation's method and path.
+func (e MockAPIResponse) matches(r *http.Request) bool {
+	if e.method() != r.Method {
+		return false
+	}
+
+	u, err := url.Parse(e.path())
+	if err != nil || u.Path != "/"+strings.TrimPrefix(r.URL.Path, "/") {
+		return false
+	}
+
+	q := r.URL.Query()
+	if len(u.Query()) == 0 && len(q) == 0 {
+		return true
+	}
+
+	return reflect.DeepEqual(u.Query(), q)
+}
+
+// consume returns the first unused expectation matching r and removes it.
+func (m *MockAPIServer) consume(r *http.Request) (MockAPIResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.callCount++
+
+	for k, e := range m.expected {
+		if e.matches(r) {
+			m.expected = append(append([]MockAPIResponse(nil), m.expected[:k]...), m.expected[k+1:]...)
+			return e, true
+		}
+	}
+
+	return MockAPIResponse{}, false
+}
+
+// serveHTTP answers a request from the first matching expectation, failing the test if there is none.
+func (m *MockAPIServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == mockPingPath {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	e, ok := m.consume(r)
+	if !ok {
+		assert.Fail(m.t, "Unexpected JSONApi request", "%s %s", r.Method, r.URL.RequestURI())
+		http.Error(w, "godb.MockAPIServer: unexpected request "+r.Method+" "+r.URL.RequestURI(), http.StatusNotImplemented)
+		return
+	}
+
+	if e.RequestBody != nil {
+		b, err := ioutil.ReadAll(r.Body)
+		if assert.NoError(m.t, err) {
+			assert.JSONEq(m.t, string(e.RequestBody), string(b), "Request body of %s %s", r.Method, r.URL.RequestURI())
+		}
+	}
+
+	if e.Delay > 0 {
+		t := time.NewTimer(e.Delay)
+		select {
+		case <-r.Context().Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+
+	for k, v := range e.Header {
+		w.Header()[k] = v
+	}
+
+	if len(e.Content) > 0 && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	body := e.Content
+	if e.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(e.Content)
+		gz.Close()
+
+		body = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
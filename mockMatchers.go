@@ -0,0 +1,176 @@
+package godb
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// QueryMatcher reports whether the query run by the code under test satisfies the expected DBResult.Query.
+type QueryMatcher func(expected, actual string) bool
+
+var (
+	// QueryEqual matches queries that are exactly equal. It is the MockDB default.
+	QueryEqual QueryMatcher = func(expected, actual string) bool {
+		return expected == actual
+	}
+
+	// QueryNormalized matches queries that are equal once runs of whitespace are collapsed. It is the AsyncMockDB default.
+	QueryNormalized QueryMatcher = func(expected, actual string) bool {
+		return transformQuery(expected) == transformQuery(actual)
+	}
+)
+
+// QueryMatchesRegexp matches queries against pattern once runs of whitespace are collapsed.
+// The pattern is compiled immediately and QueryMatchesRegexp panics if it is invalid, so mistakes surface while setting up the test.
+// The DBResult.Query is not used for matching, only in failure messages.
+func QueryMatchesRegexp(pattern string) QueryMatcher {
+	re := regexp.MustCompile(pattern)
+
+	return func(expected, actual string) bool {
+		return re.MatchString(transformQuery(actual))
+	}
+}
+
+// ArgMatcher can be used in DBResult.Args in place of a value, to accept any argument it matches.
+type ArgMatcher interface {
+	MatchArg(v interface{}) bool
+	String() string
+}
+
+type anyArg struct{}
+
+func (anyArg) MatchArg(interface{}) bool { return true }
+func (anyArg) String() string            { return "Any()" }
+
+// Any matches any argument, including nil.
+func Any() ArgMatcher {
+	return anyArg{}
+}
+
+type typeArg string
+
+func (a typeArg) MatchArg(v interface{}) bool {
+	return v != nil && reflect.TypeOf(v).String() == string(a)
+}
+
+func (a typeArg) String() string { return fmt.Sprintf("AnyOfType(%q)", string(a)) }
+
+// AnyOfType matches any argument of the named type, e.g. AnyOfType("time.Time") or AnyOfType("*string").
+func AnyOfType(name string) ArgMatcher {
+	return typeArg(name)
+}
+
+type durationArg struct {
+	expected time.Time
+	delta    time.Duration
+}
+
+func (a durationArg) MatchArg(v interface{}) bool {
+	var t time.Time
+	switch x := v.(type) {
+	case time.Time:
+		t = x
+	case *time.Time:
+		if x == nil {
+			return false
+		}
+		t = *x
+	default:
+		return false
+	}
+
+	d := t.Sub(a.expected)
+	return d >= -a.delta && d <= a.delta
+}
+
+func (a durationArg) String() string {
+	return fmt.Sprintf("WithinDuration(%s, %s)", a.expected.Format(time.RFC3339Nano), a.delta)
+}
+
+// WithinDuration matches a time.Time argument within delta of expected, e.g. WithinDuration(time.Now(), time.Second).
+func WithinDuration(expected time.Time, delta time.Duration) ArgMatcher {
+	return durationArg{expected: expected, delta: delta}
+}
+
+type funcArg func(interface{}) bool
+
+func (f funcArg) MatchArg(v interface{}) bool { return f(v) }
+func (f funcArg) String() string              { return "MatchedBy(func)" }
+
+// MatchedBy matches any argument for which fn returns true.
+func MatchedBy(fn func(v interface{}) bool) ArgMatcher {
+	return funcArg(fn)
+}
+
+// queryMatches reports whether q satisfies r, using def when r has no QueryMatcher.
+func (r DBResult) queryMatches(q string, def QueryMatcher) bool {
+	m := r.QueryMatcher
+	if m == nil {
+		m = def
+	}
+
+	return m(r.Query, q)
+}
+
+// argsMatch reports whether args satisfy r.Args.
+func (r DBResult) argsMatch(args []interface{}) bool {
+	if !hasArgMatchers(r.Args) {
+		return assert.ObjectsAreEqual(r.Args, args)
+	}
+
+	if len(r.Args) != len(args) {
+		return false
+	}
+
+	for k, e := range r.Args {
+		if m, ok := e.(ArgMatcher); ok {
+			if !m.MatchArg(args[k]) {
+				return false
+			}
+			continue
+		}
+
+		if !assert.ObjectsAreEqual(e, args[k]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasArgMatchers(args []interface{}) bool {
+	for _, a := range args {
+		if _, ok := a.(ArgMatcher); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// assertQuery fails the test if q does not satisfy r.
+func assertQuery(t *testing.T, r DBResult, q string, def QueryMatcher) bool {
+	if r.queryMatches(q, def) {
+		return true
+	}
+
+	return assert.Fail(t, "Query does not match", "expected: %s\nactual  : %s", r.Query, q)
+}
+
+// assertArgs fails the test if args do not satisfy r.Args.
+func assertArgs(t *testing.T, r DBResult, args []interface{}) bool {
+	if r.argsMatch(args) {
+		return true
+	}
+
+	if !hasArgMatchers(r.Args) {
+		return assertDeepEqual(t, r.Args, args)
+	}
+
+	return assert.Fail(t, "Args do not match", "expected: %v\nactual  : %v", r.Args, args)
+}
@@ -0,0 +1,272 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ TransactionDB = &MockDB{}
+	_ TransactionDB = &AsyncMockDB{}
+	_ Transaction   = &MockTx{}
+)
+
+// TxExpectation says whether a DBResult must be used inside or outside of a transaction.
+type TxExpectation int
+
+const (
+	// TxAny accepts the query whether or not it runs in a transaction. This is the default.
+	TxAny TxExpectation = iota
+	// TxInside requires the query to run on a Transaction returned by BeginTx.
+	TxInside
+	// TxOutside requires the query to run directly on the mock, outside of any transaction.
+	TxOutside
+)
+
+// MockTxState records the transactions begun on a MockDB or AsyncMockDB, and allows failures to be injected.
+type MockTxState struct {
+	// BeginTxError, CommitError and RollbackError are returned by BeginTx, Commit and Rollback respectively.
+	BeginTxError  error
+	CommitError   error
+	RollbackError error
+
+	BeginTxCount  int
+	CommitCount   int
+	RollbackCount int
+
+	// open counts transactions that have been begun but not yet committed or rolled back.
+	open int
+}
+
+func (s *MockTxState) begin() error {
+	s.BeginTxCount++
+	if s.BeginTxError != nil {
+		return s.BeginTxError
+	}
+
+	s.open++
+	return nil
+}
+
+func (s *MockTxState) end(commit bool) error {
+	s.open--
+
+	if commit {
+		s.CommitCount++
+		return s.CommitError
+	}
+
+	s.RollbackCount++
+	return s.RollbackError
+}
+
+func (s *MockTxState) appendUnmet(unmet []string) []string {
+	if s.open > 0 {
+		unmet = append(unmet, fmt.Sprintf("Transaction: %d neither committed nor rolled back", s.open))
+	}
+
+	return unmet
+}
+
+// txMock is implemented by the mocks that can begin a MockTx.
+type txMock interface {
+	Ping(context.Context) error
+	Stats(context.Context) sql.DBStats
+
+	fetch(q string, c interface{}, args []interface{}, inTx bool) error
+	fetchJSON(q string, args []interface{}, inTx bool) ([]byte, error)
+	exec(q string, args []interface{}, inTx bool) (sql.Result, error)
+	endTx(commit bool) error
+}
+
+// MockTx is the Transaction returned by MockDB.BeginTx and AsyncMockDB.BeginTx.
+// Its queries are matched against the expectations of the mock that began it, and are recorded as running inside a transaction.
+// Like a sql.Tx, a MockTx returns sql.ErrTxDone once it has been committed or rolled back.
+type MockTx struct {
+	db txMock
+
+	mu   sync.Mutex
+	done bool
+}
+
+// BeginTx begins a mock transaction.
+func (db *MockDB) BeginTx(context.Context) (Transaction, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.begin(); err != nil {
+		return nil, err
+	}
+
+	return &MockTx{db: db}, nil
+}
+
+func (db *MockDB) endTx(commit bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.end(commit)
+}
+
+// BeginTx begins a mock transaction.
+func (db *AsyncMockDB) BeginTx(context.Context) (Transaction, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.begin(); err != nil {
+		return nil, err
+	}
+
+	return &MockTx{db: db}, nil
+}
+
+func (db *AsyncMockDB) endTx(commit bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.end(commit)
+}
+
+func (tx *MockTx) isDone() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.done
+}
+
+func (tx *MockTx) finish(commit bool) error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	tx.mu.Unlock()
+
+	return tx.db.endTx(commit)
+}
+
+// Commit records the commit and returns the mock's CommitError.
+func (tx *MockTx) Commit() error {
+	if tx == nil {
+		return ErrEmptyObject
+	}
+
+	return tx.finish(true)
+}
+
+// Rollback records the rollback and returns the mock's RollbackError.
+func (tx *MockTx) Rollback() error {
+	if tx == nil {
+		return ErrEmptyObject
+	}
+
+	return tx.finish(false)
+}
+
+// Ping satisfies the Database interface.
+func (tx *MockTx) Ping(ctx context.Context) error {
+	if tx == nil {
+		return ErrEmptyObject
+	}
+
+	return tx.db.Ping(ctx)
+}
+
+// Shutdown satisfies the Database interface.
+func (*MockTx) Shutdown(context.Context) error {
+	return nil
+}
+
+// Stats satisfies the Database interface.
+func (tx *MockTx) Stats(ctx context.Context) sql.DBStats {
+	if tx == nil {
+		return sql.DBStats{}
+	}
+
+	return tx.db.Stats(ctx)
+}
+
+// FetchWithMetrics mocks FetchWithMetrics by simply ignoring the metrics during the unittest.
+func (tx *MockTx) FetchWithMetrics(ctx context.Context, r metrics.Recorder, q string, c interface{}, args ...interface{}) error {
+	return tx.Fetch(ctx, q, c, args...)
+}
+
+// Fetch allows for mocking the response from a fetch request made inside the transaction.
+func (tx *MockTx) Fetch(ctx context.Context, q string, c interface{}, args ...interface{}) error {
+	if tx == nil {
+		return ErrEmptyObject
+	}
+
+	if tx.isDone() {
+		return sql.ErrTxDone
+	}
+
+	return tx.db.fetch(q, c, args, true)
+}
+
+// ExecWithMetrics mocks ExecWithMetrics by simply ignoring the metrics during the unittest.
+func (tx *MockTx) ExecWithMetrics(ctx context.Context, r metrics.Recorder, q string, args ...interface{}) (sql.Result, error) {
+	return tx.Exec(ctx, q, args...)
+}
+
+// Exec allows for mocking the response from an exec request made inside the transaction.
+func (tx *MockTx) Exec(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	if tx == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if tx.isDone() {
+		return nil, sql.ErrTxDone
+	}
+
+	return tx.db.exec(q, args, true)
+}
+
+// FetchJSONWithMetrics mocks FetchJSONWithMetrics by simply ignoring the metrics during the unittest.
+func (tx *MockTx) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder, q string, args ...interface{}) ([]byte, error) {
+	return tx.FetchJSON(ctx, q, args...)
+}
+
+// FetchJSON allows for mocking the response from a fetch request made inside the transaction.
+func (tx *MockTx) FetchJSON(ctx context.Context, q string, args ...interface{}) ([]byte, error) {
+	if tx == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if tx.isDone() {
+		return nil, sql.ErrTxDone
+	}
+
+	return tx.db.fetchJSON(q, args, true)
+}
+
+func (r DBResult) txMatches(inTx bool) bool {
+	switch r.Tx {
+	case TxInside:
+		return inTx
+	case TxOutside:
+		return !inTx
+	}
+
+	return true
+}
+
+// assertTx fails the test if the query ran on the wrong side of a transaction.
+func assertTx(t *testing.T, r DBResult, q string, inTx bool) bool {
+	if r.txMatches(inTx) {
+		return true
+	}
+
+	if inTx {
+		return assert.Fail(t, "Query ran inside a transaction", "expected outside: %s", q)
+	}
+
+	return assert.Fail(t, "Query ran outside of a transaction", "expected inside: %s", q)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"database/sql"
 
@@ -18,6 +19,8 @@ import (
 // MySQLDatastore is an implementation of MySQLSQL datastore for golang.
 type MySQLDatastore struct {
 	db *sql.DB
+
+	queryLimit time.Duration
 }
 
 // NewMySQLDatastore configures and returns a usable MySQLDatastore from parameters.
@@ -37,7 +40,7 @@ func NewMySQLDatastoreCS(connectString string, maxOpen, maxIdle int) *MySQLDatas
 	db.SetMaxOpenConns(maxOpen)
 	db.SetMaxIdleConns(maxIdle)
 
-	store := &MySQLDatastore{db}
+	store := &MySQLDatastore{db: db}
 
 	err = store.Ping(context.Background())
 	if err != nil {
@@ -56,7 +59,7 @@ func (m *MySQLDatastore) Ping(ctx context.Context) error {
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -104,6 +107,14 @@ func (m *MySQLDatastore) Stats(context.Context) sql.DBStats {
 	return sql.DBStats{}
 }
 
+// SetQueryLimit sets the default timeout applied to queries against this datastore when the context has no deadline.
+// A limit of zero falls back to the package level QueryLimit. SetQueryLimit should be called before the datastore is in use.
+func (m *MySQLDatastore) SetQueryLimit(limit time.Duration) {
+	if m != nil {
+		m.queryLimit = limit
+	}
+}
+
 // Fetch provides a simple query-and-get operation. We will run your query and fill your container.
 func (m *MySQLDatastore) Fetch(ctx context.Context, query string, container interface{}, args ...interface{}) error {
 	if m == nil {
@@ -112,7 +123,7 @@ func (m *MySQLDatastore) Fetch(ctx context.Context, query string, container inte
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -122,7 +133,9 @@ func (m *MySQLDatastore) Fetch(ctx context.Context, query string, container inte
 	}
 
 	defer rows.Close()
+	done := traceUnmarshal(ctx)
 	err = Unmarshal(rows, &container)
+	done(err)
 	return err
 }
 
@@ -134,7 +147,7 @@ func (m *MySQLDatastore) FetchWithMetrics(ctx context.Context, r metrics.Recorde
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -148,7 +161,9 @@ func (m *MySQLDatastore) FetchWithMetrics(ctx context.Context, r metrics.Recorde
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::UnmarshalWithMetrics")
+	done := traceUnmarshal(ctx)
 	err = UnmarshalWithMetrics(r, rows, &container)
+	done(err)
 	end()
 	return err
 }
@@ -161,7 +176,7 @@ func (m *MySQLDatastore) FetchJSON(ctx context.Context, query string, args ...in
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -172,7 +187,11 @@ func (m *MySQLDatastore) FetchJSON(ctx context.Context, query string, args ...in
 
 	defer rows.Close()
 
-	return ToJSON(rows)
+	done := traceUnmarshal(ctx)
+	j, err := ToJSON(rows)
+	done(err)
+
+	return j, err
 }
 
 // FetchJSONWithMetrics provides a simple query-and-get operation. We will run your query and give you back the JSON representing your result set.
@@ -183,7 +202,7 @@ func (m *MySQLDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.Rec
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -197,7 +216,9 @@ func (m *MySQLDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.Rec
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::FetchJSONWithMetrics")
+	done := traceUnmarshal(ctx)
 	j, err := ToJSON(rows)
+	done(err)
 	end()
 
 	return j, err
@@ -212,7 +233,7 @@ func (m *MySQLDatastore) Exec(ctx context.Context, query string, args ...interfa
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -228,7 +249,7 @@ func (m *MySQLDatastore) ExecWithMetrics(ctx context.Context, r metrics.Recorder
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
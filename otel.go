@@ -0,0 +1,213 @@
+package godb
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const otelInstrumentationName = "github.com/btm6084/godb"
+
+var _ Interceptor = (*OTelInterceptor)(nil)
+
+// OTelConfig configures an OTelInterceptor.
+type OTelConfig struct {
+	// System is reported as the db.system attribute, e.g. "postgresql", "mysql", "mssql" or "sqlite".
+	System string
+
+	// TracerProvider defaults to otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider defaults to otel.GetMeterProvider().
+	MeterProvider metric.MeterProvider
+
+	// OmitStatement leaves db.statement off of spans, for queries that may embed sensitive literals.
+	OmitStatement bool
+}
+
+// OTelInterceptor is an Interceptor that creates an OpenTelemetry span for each Fetch, FetchJSON, Exec,
+// BeginTx, Commit and Rollback, and records their duration in a histogram.
+// Use it with Wrap: godb.Wrap(db, interceptor).
+type OTelInterceptor struct {
+	system        string
+	omitStatement bool
+
+	tracer   trace.Tracer
+	meter    metric.Meter
+	duration metric.Float64Histogram
+}
+
+type otelSpanKey struct{}
+
+// NewOTelInterceptor returns an OTelInterceptor using the given configuration.
+func NewOTelInterceptor(cfg OTelConfig) (*OTelInterceptor, error) {
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+
+	meter := cfg.MeterProvider.Meter(otelInstrumentationName)
+
+	duration, err := meter.Float64Histogram(
+		"db.client.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of database client operations."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OTelInterceptor{
+		system:        cfg.System,
+		omitStatement: cfg.OmitStatement,
+		tracer:        cfg.TracerProvider.Tracer(otelInstrumentationName),
+		meter:         meter,
+		duration:      duration,
+	}, nil
+}
+
+// Before starts a client span for the call.
+func (o *OTelInterceptor) Before(ctx context.Context, info *QueryInfo) (context.Context, error) {
+	op := dbOperation(info)
+
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", o.system),
+		attribute.String("db.operation", op),
+		attribute.Bool("godb.in_transaction", info.InTx),
+	}
+
+	if info.Query != "" && !o.omitStatement {
+		attrs = append(attrs, attribute.String("db.statement", info.Query))
+	}
+
+	name := op
+	if o.system != "" {
+		name = op + " " + o.system
+	}
+
+	ctx, span := o.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	return context.WithValue(ctx, otelSpanKey{}, span), nil
+}
+
+// After ends the span started by Before and records the call duration.
+func (o *OTelInterceptor) After(ctx context.Context, info *QueryInfo) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", o.system),
+		attribute.String("db.operation", dbOperation(info)),
+	}
+
+	o.duration.Record(ctx, info.Duration.Seconds(), metric.WithAttributes(attrs...))
+
+	span, ok := ctx.Value(otelSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if info.RowsAffected >= 0 {
+		span.SetAttributes(attribute.Int64("db.rows_affected", info.RowsAffected))
+	}
+
+	if info.Err != nil {
+		span.RecordError(info.Err)
+		span.SetStatus(codes.Error, info.Err.Error())
+	}
+
+	span.End()
+}
+
+// ObserveStats registers asynchronous gauges reporting the connection pool statistics returned by db.Stats.
+// name is reported as the pool.name attribute, so that several datastores can be told apart.
+// Call Unregister on the returned Registration when the datastore is shut down.
+func (o *OTelInterceptor) ObserveStats(name string, db Database) (metric.Registration, error) {
+	usage, err := o.meter.Int64ObservableGauge("db.client.connections.usage", metric.WithUnit("{connection}"),
+		metric.WithDescription("The number of connections that are currently in the state described by the state attribute."))
+	if err != nil {
+		return nil, err
+	}
+
+	maxOpen, err := o.meter.Int64ObservableGauge("db.client.connections.max", metric.WithUnit("{connection}"),
+		metric.WithDescription("The maximum number of open connections allowed."))
+	if err != nil {
+		return nil, err
+	}
+
+	waits, err := o.meter.Int64ObservableCounter("db.client.connections.wait_count", metric.WithUnit("{wait}"),
+		metric.WithDescription("The total number of connections waited for."))
+	if err != nil {
+		return nil, err
+	}
+
+	waitTime, err := o.meter.Float64ObservableCounter("db.client.connections.wait_time", metric.WithUnit("s"),
+		metric.WithDescription("The total time blocked waiting for a new connection."))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := attribute.String("pool.name", name)
+	system := attribute.String("db.system", o.system)
+
+	return o.meter.RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
+		s := db.Stats(ctx)
+
+		obs.ObserveInt64(usage, int64(s.Idle), metric.WithAttributes(system, pool, attribute.String("state", "idle")))
+		obs.ObserveInt64(usage, int64(s.InUse), metric.WithAttributes(system, pool, attribute.String("state", "used")))
+		obs.ObserveInt64(maxOpen, int64(s.MaxOpenConnections), metric.WithAttributes(system, pool))
+		obs.ObserveInt64(waits, s.WaitCount, metric.WithAttributes(system, pool))
+		obs.ObserveFloat64(waitTime, s.WaitDuration.Seconds(), metric.WithAttributes(system, pool))
+
+		return nil
+	}, usage, maxOpen, waits, waitTime)
+}
+
+// dbOperation returns the SQL keyword the query starts with, or the godb operation if there is no query.
+func dbOperation(info *QueryInfo) string {
+	switch info.Operation {
+	case OpBeginTx:
+		return "BEGIN"
+	case OpCommit:
+		return "COMMIT"
+	case OpRollback:
+		return "ROLLBACK"
+	}
+
+	fields := strings.Fields(info.Query)
+	if len(fields) == 0 {
+		return info.Operation
+	}
+
+	return strings.ToUpper(strings.TrimLeft(fields[0], "("))
+}
+
+// traceUnmarshal adds span events marking the start and end of the unmarshal phase to the span in ctx.
+// It does nothing when there is no recording span.
+func traceUnmarshal(ctx context.Context) func(error) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	span.AddEvent("godb.unmarshal.start")
+
+	return func(err error) {
+		attrs := []attribute.KeyValue{
+			attribute.Float64("godb.unmarshal.duration", time.Since(start).Seconds()),
+		}
+
+		if err != nil {
+			attrs = append(attrs, attribute.String("error", err.Error()))
+		}
+
+		span.AddEvent("godb.unmarshal.end", trace.WithAttributes(attrs...))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/btm6084/utilities/metrics"
 	"github.com/btm6084/utilities/stack"
@@ -17,6 +18,8 @@ import (
 // PostgresDatastore is an implementation of PostgresSQL datastore for golang.
 type PostgresDatastore struct {
 	db *sql.DB
+
+	queryLimit time.Duration
 }
 
 // NewPostgresDatastore configures and returns a usable PostgresDatastore from parameters.
@@ -36,7 +39,7 @@ func NewPostgresDatastoreCS(connectString string, maxOpen, maxIdle int) *Postgre
 	db.SetMaxOpenConns(maxOpen)
 	db.SetMaxIdleConns(maxIdle)
 
-	store := &PostgresDatastore{db}
+	store := &PostgresDatastore{db: db}
 
 	err = store.Ping(context.Background())
 	if err != nil {
@@ -59,7 +62,7 @@ func (p *PostgresDatastore) Ping(ctx context.Context) error {
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -101,6 +104,14 @@ func (p *PostgresDatastore) Stats(context.Context) sql.DBStats {
 	return sql.DBStats{}
 }
 
+// SetQueryLimit sets the default timeout applied to queries against this datastore when the context has no deadline.
+// A limit of zero falls back to the package level QueryLimit. SetQueryLimit should be called before the datastore is in use.
+func (p *PostgresDatastore) SetQueryLimit(limit time.Duration) {
+	if p != nil {
+		p.queryLimit = limit
+	}
+}
+
 // Begin starts a single transaction. You MUST call Transaction.Rollback, or Transaction.Commit after calling Begin, or you WILL
 // leak memory.
 // It is safe to defer Transaction.Rollback immediately, even if you don't intend to rollback.
@@ -111,7 +122,7 @@ func (p *PostgresDatastore) BeginTx(ctx context.Context) (Transaction, error) {
 		return nil, err
 	}
 
-	return &PostgresTx{db: p.db, tx: tx}, nil
+	return &PostgresTx{db: p.db, tx: tx, queryLimit: p.queryLimit}, nil
 }
 
 // Fetch provides a simple query-and-get operation. We will run your query and fill your container.
@@ -122,7 +133,7 @@ func (p *PostgresDatastore) Fetch(ctx context.Context, query string, container i
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -136,7 +147,9 @@ func (p *PostgresDatastore) Fetch(ctx context.Context, query string, container i
 	}
 
 	defer rows.Close()
+	done := traceUnmarshal(ctx)
 	err = Unmarshal(rows, &container)
+	done(err)
 	return err
 }
 
@@ -148,7 +161,7 @@ func (p *PostgresDatastore) FetchWithMetrics(ctx context.Context, r metrics.Reco
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -166,7 +179,9 @@ func (p *PostgresDatastore) FetchWithMetrics(ctx context.Context, r metrics.Reco
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::UnmarshalWithMetrics")
+	done := traceUnmarshal(ctx)
 	err = UnmarshalWithMetrics(r, rows, &container)
+	done(err)
 	end()
 	return err
 }
@@ -179,7 +194,7 @@ func (p *PostgresDatastore) FetchJSON(ctx context.Context, query string, args ..
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -194,7 +209,11 @@ func (p *PostgresDatastore) FetchJSON(ctx context.Context, query string, args ..
 
 	defer rows.Close()
 
-	return ToJSON(rows)
+	done := traceUnmarshal(ctx)
+	j, err := ToJSON(rows)
+	done(err)
+
+	return j, err
 }
 
 // FetchJSONWithMetrics provides a simple query-and-get operation. We will run your query and give you back the JSON representing your result set.
@@ -205,7 +224,7 @@ func (p *PostgresDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -223,7 +242,9 @@ func (p *PostgresDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::FetchJSONWithMetrics")
+	done := traceUnmarshal(ctx)
 	j, err := ToJSON(rows)
+	done(err)
 	end()
 
 	return j, err
@@ -244,7 +265,7 @@ func (p *PostgresDatastore) ExecWithMetrics(ctx context.Context, r metrics.Recor
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -267,6 +288,8 @@ func (p *PostgresDatastore) ExecWithMetrics(ctx context.Context, r metrics.Recor
 type PostgresTx struct {
 	db *sql.DB
 	tx *sql.Tx
+
+	queryLimit time.Duration
 }
 
 // Ping sends a ping to the server and returns an error if it cannot connect.
@@ -281,7 +304,7 @@ func (p *PostgresTx) Ping(ctx context.Context) error {
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -330,7 +353,7 @@ func (p *PostgresTx) FetchWithMetrics(ctx context.Context, r metrics.Recorder, q
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -348,7 +371,9 @@ func (p *PostgresTx) FetchWithMetrics(ctx context.Context, r metrics.Recorder, q
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::UnmarshalWithMetrics")
+	done := traceUnmarshal(ctx)
 	err = UnmarshalWithMetrics(r, rows, &container)
+	done(err)
 	end()
 	return err
 }
@@ -368,7 +393,7 @@ func (p *PostgresTx) ExecWithMetrics(ctx context.Context, r metrics.Recorder, qu
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -400,7 +425,7 @@ func (p *PostgresTx) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorde
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, p.queryLimit))
 		defer cancel()
 	}
 
@@ -414,7 +439,9 @@ func (p *PostgresTx) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorde
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::FetchJSONWithMetrics")
+	done := traceUnmarshal(ctx)
 	j, err := ToJSON(rows)
+	done(err)
 	end()
 
 	return j, err
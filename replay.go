@@ -0,0 +1,380 @@
+package godb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/btm6084/gojson"
+	"github.com/btm6084/utilities/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ Database = &ReplayDB{}
+
+// ReplayMode selects whether a ReplayDB records or replays.
+type ReplayMode int
+
+const (
+	// Replay serves calls from the golden file. Each call must match the next recording exactly.
+	Replay ReplayMode = iota
+	// Record proxies calls to a real datastore and writes them to the golden file when the test ends.
+	Record
+)
+
+// ReplayFixture is a single call saved in a ReplayDB golden file.
+type ReplayFixture struct {
+	Operation string          `json:"operation"`
+	Query     string          `json:"query"`
+	Args      json.RawMessage `json:"args,omitempty"`
+
+	// Content is the JSON result of a Fetch or FetchJSON.
+	Content json.RawMessage `json:"content,omitempty"`
+
+	// RowsAffected and LastInsertID are the result of an Exec.
+	RowsAffected int64 `json:"rows_affected,omitempty"`
+	LastInsertID int64 `json:"last_insert_id,omitempty"`
+
+	// Error is the message of the error returned by the call, if any.
+	Error string `json:"error,omitempty"`
+
+	// Sentinel names the well known error the recorded error matched with errors.Is, e.g. "sql.ErrNoRows",
+	// so that the replayed error matches it too.
+	Sentinel string `json:"sentinel,omitempty"`
+}
+
+// replaySentinels are the errors a ReplayDB preserves identity for, in the order they are tested.
+var replaySentinels = []struct {
+	name string
+	err  error
+}{
+	{"sql.ErrNoRows", sql.ErrNoRows},
+	{"godb.ErrNotFound", ErrNotFound},
+	{"godb.ErrConflict", ErrConflict},
+	{"godb.ErrUnprocessableEntity", ErrUnprocessableEntity},
+	{"context.DeadlineExceeded", context.DeadlineExceeded},
+	{"context.Canceled", context.Canceled},
+}
+
+// replayError is a replayed error. It has the recorded message, and wraps the recorded sentinel, if any.
+type replayError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *replayError) Error() string { return e.msg }
+func (e *replayError) Unwrap() error { return e.sentinel }
+
+// ReplayDB is a Database for tests that records real query results to a golden file and replays them offline.
+// In Record mode every Fetch, FetchJSON and Exec is passed to the wrapped datastore and saved.
+// In Replay mode the wrapped datastore is not used; calls are answered from the golden file in the order they were recorded,
+// and the test fails on any call whose operation, query or args differ from the recording, or if recordings are left unused.
+// Errors are replayed with their message, and still match sql.ErrNoRows, ErrNotFound, ErrConflict, ErrUnprocessableEntity,
+// context.DeadlineExceeded and context.Canceled with errors.Is. Transactions are not supported.
+type ReplayDB struct {
+	t    *testing.T
+	mode ReplayMode
+	path string
+	db   Database
+
+	mu       sync.Mutex
+	fixtures []ReplayFixture
+	pointer  int
+}
+
+// NewReplayDB returns a ReplayDB using the golden file at path. db is only used, and must only be set, in Record mode.
+// In Record mode the golden file is written when the test ends; in Replay mode it is read immediately.
+func NewReplayDB(t *testing.T, path string, mode ReplayMode, db Database) *ReplayDB {
+	r := &ReplayDB{t: t, mode: mode, path: path, db: db}
+
+	if mode == Record {
+		if db == nil {
+			t.Fatal("godb.ReplayDB: Record mode requires a Database")
+		}
+
+		t.Cleanup(func() {
+			assert.NoError(t, r.Save())
+		})
+
+		return r
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("godb.ReplayDB: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &r.fixtures); err != nil {
+		t.Fatalf("godb.ReplayDB: %s: %v", path, err)
+	}
+
+	t.Cleanup(func() {
+		assert.NoError(t, r.ExpectationsWereMet())
+	})
+
+	return r
+}
+
+// Save writes the calls recorded so far to the golden file. It is called automatically when a recording test ends.
+func (r *ReplayDB) Save() error {
+	if r == nil {
+		return ErrEmptyObject
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := json.MarshalIndent(r.fixtures, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, append(b, '\n'), 0o644)
+}
+
+// ExpectationsWereMet returns an error listing every recorded call that was not replayed.
+func (r *ReplayDB) ExpectationsWereMet() error {
+	if r == nil {
+		return ErrEmptyObject
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == Record || r.pointer >= len(r.fixtures) {
+		return nil
+	}
+
+	var unmet []string
+	for _, f := range r.fixtures[r.pointer:] {
+		unmet = append(unmet, fmt.Sprintf("%s: %s %s", f.Operation, f.Query, f.Args))
+	}
+
+	return unmetError(unmet)
+}
+
+// record saves a call made in Record mode.
+func (r *ReplayDB) record(f ReplayFixture, args []interface{}, err error) {
+	if len(args) > 0 {
+		b, jerr := json.Marshal(args)
+		if !assert.NoError(r.t, jerr, "godb.ReplayDB: args of %s", f.Query) {
+			return
+		}
+		f.Args = b
+	}
+
+	if err != nil {
+		f.Error = err.Error()
+		f.Content = nil
+
+		for _, s := range replaySentinels {
+			if errors.Is(err, s.err) {
+				f.Sentinel = s.name
+				break
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.fixtures = append(r.fixtures, f)
+	r.mu.Unlock()
+}
+
+// replay returns the next recording, failing the test unless it matches the call.
+func (r *ReplayDB) replay(op, q string, args []interface{}) (ReplayFixture, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pointer >= len(r.fixtures) {
+		assert.Fail(r.t, "godb.ReplayDB: all recordings used", "unexpected %s: %s", op, q)
+		return ReplayFixture{}, ErrMockMismatch
+	}
+
+	f := r.fixtures[r.pointer]
+	r.pointer++
+
+	var actual json.RawMessage
+	if len(args) > 0 {
+		b, err := json.Marshal(args)
+		if !assert.NoError(r.t, err, "godb.ReplayDB: args of %s", q) {
+			return ReplayFixture{}, ErrMockMismatch
+		}
+		actual = b
+	}
+
+	if !assert.Equal(r.t, f.Operation, op, "godb.ReplayDB: operation") ||
+		!assert.Equal(r.t, f.Query, q, "godb.ReplayDB: query") ||
+		!assert.JSONEq(r.t, orNull(f.Args), orNull(actual), "godb.ReplayDB: args of %s", q) {
+		return ReplayFixture{}, ErrMockMismatch
+	}
+
+	if f.Error != "" {
+		e := &replayError{msg: f.Error}
+		for _, s := range replaySentinels {
+			if s.name == f.Sentinel {
+				e.sentinel = s.err
+				break
+			}
+		}
+
+		return f, e
+	}
+
+	return f, nil
+}
+
+func orNull(b json.RawMessage) string {
+	if len(b) == 0 {
+		return "null"
+	}
+
+	return string(b)
+}
+
+// Ping pings the wrapped datastore when recording, and succeeds when replaying.
+func (r *ReplayDB) Ping(ctx context.Context) error {
+	if r == nil {
+		return ErrEmptyObject
+	}
+
+	if r.mode == Record {
+		return r.db.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Shutdown shuts down the wrapped datastore when recording, and does nothing when replaying.
+func (r *ReplayDB) Shutdown(ctx context.Context) error {
+	if r == nil {
+		return ErrEmptyObject
+	}
+
+	if r.mode == Record {
+		return r.db.Shutdown(ctx)
+	}
+
+	return nil
+}
+
+// Stats returns the stats of the wrapped datastore when recording, and empty stats when replaying.
+func (r *ReplayDB) Stats(ctx context.Context) sql.DBStats {
+	if r == nil || r.mode != Record {
+		return sql.DBStats{}
+	}
+
+	return r.db.Stats(ctx)
+}
+
+// Fetch records or replays a fetch request.
+func (r *ReplayDB) Fetch(ctx context.Context, query string, container interface{}, args ...interface{}) error {
+	if r == nil {
+		return ErrEmptyObject
+	}
+
+	return r.FetchWithMetrics(ctx, &metrics.NoOp{}, query, container, args...)
+}
+
+// FetchWithMetrics records or replays a fetch request.
+// When recording, the rows are fetched as JSON so that they can be saved, then unmarshaled into your container.
+func (r *ReplayDB) FetchWithMetrics(ctx context.Context, rec metrics.Recorder, query string, container interface{}, args ...interface{}) error {
+	if r == nil {
+		return ErrEmptyObject
+	}
+
+	var (
+		j   []byte
+		err error
+	)
+
+	if r.mode == Record {
+		j, err = r.db.FetchJSONWithMetrics(ctx, rec, query, args...)
+		r.record(ReplayFixture{Operation: OpFetch, Query: query, Content: j}, args, err)
+	} else {
+		var f ReplayFixture
+		f, err = r.replay(OpFetch, query, args)
+		j = f.Content
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return gojson.Unmarshal(j, &container)
+}
+
+// FetchJSON records or replays a fetch request.
+func (r *ReplayDB) FetchJSON(ctx context.Context, query string, args ...interface{}) ([]byte, error) {
+	if r == nil {
+		return nil, ErrEmptyObject
+	}
+
+	return r.FetchJSONWithMetrics(ctx, &metrics.NoOp{}, query, args...)
+}
+
+// FetchJSONWithMetrics records or replays a fetch request.
+func (r *ReplayDB) FetchJSONWithMetrics(ctx context.Context, rec metrics.Recorder, query string, args ...interface{}) ([]byte, error) {
+	if r == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if r.mode == Record {
+		j, err := r.db.FetchJSONWithMetrics(ctx, rec, query, args...)
+		r.record(ReplayFixture{Operation: OpFetchJSON, Query: query, Content: j}, args, err)
+		return j, err
+	}
+
+	f, err := r.replay(OpFetchJSON, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(f.Content), nil
+}
+
+// Exec records or replays an exec request.
+func (r *ReplayDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if r == nil {
+		return nil, ErrEmptyObject
+	}
+
+	return r.ExecWithMetrics(ctx, &metrics.NoOp{}, query, args...)
+}
+
+// ExecWithMetrics records or replays an exec request.
+func (r *ReplayDB) ExecWithMetrics(ctx context.Context, rec metrics.Recorder, query string, args ...interface{}) (sql.Result, error) {
+	if r == nil {
+		return nil, ErrEmptyObject
+	}
+
+	if r.mode == Record {
+		res, err := r.db.ExecWithMetrics(ctx, rec, query, args...)
+
+		f := ReplayFixture{Operation: OpExec, Query: query}
+		if res != nil {
+			f.RowsAffected, _ = res.RowsAffected()
+			f.LastInsertID, _ = res.LastInsertId()
+		}
+
+		r.record(f, args, err)
+		return res, err
+	}
+
+	f, err := r.replay(OpExec, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLResult{Affected: f.RowsAffected, InsertID: f.LastInsertID}, nil
+}
@@ -0,0 +1,299 @@
+package godb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+var (
+	_ Rows = &sql.Rows{}
+	_ Rows = &FakeRows{}
+)
+
+// Rows is the part of *sql.Rows used by ToJSON and Unmarshal. It allows result sets to be faked in tests; see FakeRows.
+type Rows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// isNilRows reports whether rows is nil, including a nil *sql.Rows held in the interface.
+func isNilRows(rows Rows) bool {
+	if rows == nil {
+		return true
+	}
+
+	r, ok := rows.(*sql.Rows)
+	return ok && r == nil
+}
+
+// FakeRows is an in-memory result set for testing code that reads Rows.
+// Values are converted as a database/sql driver would: ints to int64, floats to float64, and nil to NULL.
+// Scan accepts the same kinds of destinations as *sql.Rows, including sql.RawBytes and sql.Scanner.
+//
+//	rows := NewFakeRows("id", "name").AddRow(1, "Jane").AddRow(2, nil).
+//		AddResultSet("total").AddRow(2)
+type FakeRows struct {
+	sets []*fakeResultSet
+	set  int
+	row  int
+
+	closed   bool
+	closeErr error
+	err      error
+}
+
+type fakeResultSet struct {
+	columns []string
+	types   []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// NewFakeRows returns FakeRows whose first result set has the given columns.
+func NewFakeRows(columns ...string) *FakeRows {
+	return &FakeRows{sets: []*fakeResultSet{{columns: columns}}, row: -1}
+}
+
+func (f *FakeRows) current() *fakeResultSet {
+	return f.sets[len(f.sets)-1]
+}
+
+// WithTypes sets the database type names, e.g. "INT" or "VARCHAR", of the columns in the last result set.
+func (f *FakeRows) WithTypes(types ...string) *FakeRows {
+	f.current().types = types
+	return f
+}
+
+// AddRow adds a row to the last result set. Use nil for NULL.
+func (f *FakeRows) AddRow(values ...interface{}) *FakeRows {
+	rs := f.current()
+	if f.err == nil && len(values) != len(rs.columns) {
+		f.err = fmt.Errorf("godb.FakeRows: row has %d values for %d columns", len(values), len(rs.columns))
+	}
+
+	row := make([]driver.Value, len(values))
+	for k, v := range values {
+		dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+		if err != nil && f.err == nil {
+			f.err = fmt.Errorf("godb.FakeRows: column %d: %w", k, err)
+		}
+		row[k] = dv
+	}
+
+	rs.rows = append(rs.rows, row)
+	return f
+}
+
+// AddResultSet starts a new result set with the given columns, reached with NextResultSet.
+func (f *FakeRows) AddResultSet(columns ...string) *FakeRows {
+	f.sets = append(f.sets, &fakeResultSet{columns: columns})
+	return f
+}
+
+// RowError makes Err return err once the rows of the last result set have been read, as if iteration had failed.
+func (f *FakeRows) RowError(err error) *FakeRows {
+	f.current().err = err
+	return f
+}
+
+// CloseError makes Close return err.
+func (f *FakeRows) CloseError(err error) *FakeRows {
+	f.closeErr = err
+	return f
+}
+
+// Columns returns the column names of the current result set.
+func (f *FakeRows) Columns() ([]string, error) {
+	if f.closed {
+		return nil, errors.New("sql: Rows are closed")
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return append([]string(nil), f.sets[f.set].columns...), nil
+}
+
+// ColumnTypeNames returns the database type names of the current result set set by WithTypes.
+func (f *FakeRows) ColumnTypeNames() []string {
+	return append([]string(nil), f.sets[f.set].types...)
+}
+
+// Next prepares the next row for Scan, returning false when there are no more rows in the current result set.
+func (f *FakeRows) Next() bool {
+	if f.closed || f.err != nil {
+		return false
+	}
+
+	if f.row < len(f.sets[f.set].rows) {
+		f.row++
+	}
+
+	return f.row < len(f.sets[f.set].rows)
+}
+
+// NextResultSet advances to the next result set, returning false if there are no more.
+func (f *FakeRows) NextResultSet() bool {
+	if f.closed || f.set >= len(f.sets)-1 {
+		return false
+	}
+
+	f.set++
+	f.row = -1
+	return true
+}
+
+// Err returns the error set with RowError once the rows of the current result set have been read.
+func (f *FakeRows) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+
+	if f.row >= len(f.sets[f.set].rows) {
+		return f.sets[f.set].err
+	}
+
+	return nil
+}
+
+// Close closes the rows, returning the error set with CloseError.
+func (f *FakeRows) Close() error {
+	f.closed = true
+	return f.closeErr
+}
+
+// Scan copies the columns of the current row into dest.
+func (f *FakeRows) Scan(dest ...interface{}) error {
+	if f.closed {
+		return errors.New("sql: Rows are closed")
+	}
+
+	rs := f.sets[f.set]
+	if f.row < 0 || f.row >= len(rs.rows) {
+		return errors.New("sql: Scan called without calling Next")
+	}
+
+	row := rs.rows[f.row]
+	if len(dest) != len(row) {
+		return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(row), len(dest))
+	}
+
+	for k, src := range row {
+		if err := fakeScan(dest[k], src); err != nil {
+			return fmt.Errorf("sql: Scan error on column index %d, name %q: %w", k, rs.columns[k], err)
+		}
+	}
+
+	return nil
+}
+
+// fakeScan converts a driver value into dest, covering the common destinations supported by database/sql.
+func fakeScan(dest interface{}, src driver.Value) error {
+	switch d := dest.(type) {
+	case sql.Scanner:
+		return d.Scan(src)
+	case *sql.RawBytes:
+		*d = valueBytes(src)
+		return nil
+	case *[]byte:
+		*d = valueBytes(src)
+		return nil
+	case *interface{}:
+		if b, ok := src.([]byte); ok {
+			src = append([]byte(nil), b...)
+		}
+		*d = src
+		return nil
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("destination not a pointer")
+	}
+
+	ev := rv.Elem()
+
+	if src == nil {
+		switch ev.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			ev.Set(reflect.Zero(ev.Type()))
+			return nil
+		}
+		return fmt.Errorf("converting NULL to %s is unsupported", ev.Kind())
+	}
+
+	if ev.Kind() == reflect.Ptr {
+		p := reflect.New(ev.Type().Elem())
+		if err := fakeScan(p.Interface(), src); err != nil {
+			return err
+		}
+		ev.Set(p)
+		return nil
+	}
+
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+
+	var (
+		v   interface{}
+		err error
+	)
+
+	switch {
+	case ev.Type() == reflect.TypeOf(time.Time{}):
+		v, err = cast.ToTimeE(src)
+	case ev.Kind() == reflect.String:
+		v = string(valueBytes(src))
+	case ev.Kind() == reflect.Bool:
+		v, err = cast.ToBoolE(src)
+	case ev.Kind() >= reflect.Int && ev.Kind() <= reflect.Int64:
+		v, err = cast.ToInt64E(src)
+	case ev.Kind() >= reflect.Uint && ev.Kind() <= reflect.Uint64:
+		v, err = cast.ToUint64E(src)
+	case ev.Kind() == reflect.Float32 || ev.Kind() == reflect.Float64:
+		v, err = cast.ToFloat64E(src)
+	default:
+		return fmt.Errorf("unsupported Scan, storing %T into type %T", src, dest)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ev.Set(reflect.ValueOf(v).Convert(ev.Type()))
+	return nil
+}
+
+// valueBytes renders a driver value as the bytes a text protocol driver would return for it.
+func valueBytes(v driver.Value) []byte {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return append([]byte(nil), x...)
+	case string:
+		return []byte(x)
+	case int64:
+		return strconv.AppendInt(nil, x, 10)
+	case float64:
+		return strconv.AppendFloat(nil, x, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(nil, x)
+	case time.Time:
+		return []byte(x.Format(time.RFC3339Nano))
+	}
+
+	return []byte(fmt.Sprint(v))
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/btm6084/utilities/metrics"
 	"github.com/btm6084/utilities/stack"
@@ -17,6 +18,8 @@ import (
 // SQLiteDatastore is an implementation of SQLiteSQL datastore for golang.
 type SQLiteDatastore struct {
 	db *sql.DB
+
+	queryLimit time.Duration
 }
 
 // NewSQLiteDatastore configures and returns a usable SQLiteDatastore
@@ -30,7 +33,7 @@ func NewSQLiteDatastore(file string, maxOpen, maxIdle int) *SQLiteDatastore {
 	db.SetMaxOpenConns(maxOpen)
 	db.SetMaxIdleConns(maxIdle)
 
-	store := &SQLiteDatastore{db}
+	store := &SQLiteDatastore{db: db}
 
 	err = store.Ping(context.Background())
 	if err != nil {
@@ -49,7 +52,7 @@ func (s *SQLiteDatastore) Ping(ctx context.Context) error {
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
@@ -93,6 +96,14 @@ func (s *SQLiteDatastore) Stats(context.Context) sql.DBStats {
 	return sql.DBStats{}
 }
 
+// SetQueryLimit sets the default timeout applied to queries against this datastore when the context has no deadline.
+// A limit of zero falls back to the package level QueryLimit. SetQueryLimit should be called before the datastore is in use.
+func (s *SQLiteDatastore) SetQueryLimit(limit time.Duration) {
+	if s != nil {
+		s.queryLimit = limit
+	}
+}
+
 // Fetch provides a simple query-and-get operation. We will run your query and fill your container.
 func (s *SQLiteDatastore) Fetch(ctx context.Context, query string, container interface{}, args ...interface{}) error {
 	if s == nil {
@@ -101,7 +112,7 @@ func (s *SQLiteDatastore) Fetch(ctx context.Context, query string, container int
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
@@ -111,7 +122,9 @@ func (s *SQLiteDatastore) Fetch(ctx context.Context, query string, container int
 	}
 
 	defer rows.Close()
+	done := traceUnmarshal(ctx)
 	err = Unmarshal(rows, &container)
+	done(err)
 	return err
 }
 
@@ -123,7 +136,7 @@ func (s *SQLiteDatastore) FetchWithMetrics(ctx context.Context, r metrics.Record
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
@@ -137,7 +150,9 @@ func (s *SQLiteDatastore) FetchWithMetrics(ctx context.Context, r metrics.Record
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::UnmarshalWithMetrics")
+	done := traceUnmarshal(ctx)
 	err = UnmarshalWithMetrics(r, rows, &container)
+	done(err)
 	end()
 	return err
 }
@@ -150,7 +165,7 @@ func (s *SQLiteDatastore) FetchJSON(ctx context.Context, query string, args ...i
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
@@ -161,7 +176,11 @@ func (s *SQLiteDatastore) FetchJSON(ctx context.Context, query string, args ...i
 
 	defer rows.Close()
 
-	return ToJSON(rows)
+	done := traceUnmarshal(ctx)
+	j, err := ToJSON(rows)
+	done(err)
+
+	return j, err
 }
 
 // FetchJSONWithMetrics provides a simple query-and-get operation. We will run your query and give you back the JSON representing your result set.
@@ -172,7 +191,7 @@ func (s *SQLiteDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.Re
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
@@ -186,7 +205,9 @@ func (s *SQLiteDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.Re
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::FetchJSONWithMetrics")
+	done := traceUnmarshal(ctx)
 	j, err := ToJSON(rows)
+	done(err)
 	end()
 
 	return j, err
@@ -201,7 +222,7 @@ func (s *SQLiteDatastore) Exec(ctx context.Context, query string, args ...interf
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
@@ -217,7 +238,7 @@ func (s *SQLiteDatastore) ExecWithMetrics(ctx context.Context, r metrics.Recorde
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, s.queryLimit))
 		defer cancel()
 	}
 
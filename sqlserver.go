@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/btm6084/utilities/metrics"
 	"github.com/btm6084/utilities/stack"
@@ -19,6 +20,8 @@ import (
 // MSSQLDatastore is an implementation of MSSQLDatastore datastore for golang.
 type MSSQLDatastore struct {
 	db *sql.DB
+
+	queryLimit time.Duration
 }
 
 // NewMSSQLDatastore configures and returns a usable MSSQLDatastore from parameters.
@@ -50,7 +53,7 @@ func NewMSSQLDatastoreCS(connectString string, maxOpen, maxIdle int) *MSSQLDatas
 	db.SetMaxOpenConns(maxOpen)
 	db.SetMaxIdleConns(maxIdle)
 
-	store := &MSSQLDatastore{db}
+	store := &MSSQLDatastore{db: db}
 
 	err = store.Ping(context.Background())
 	if err != nil {
@@ -73,7 +76,7 @@ func (m *MSSQLDatastore) Ping(ctx context.Context) error {
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -111,6 +114,14 @@ func (m *MSSQLDatastore) Stats(context.Context) sql.DBStats {
 	return sql.DBStats{}
 }
 
+// SetQueryLimit sets the default timeout applied to queries against this datastore when the context has no deadline.
+// A limit of zero falls back to the package level QueryLimit. SetQueryLimit should be called before the datastore is in use.
+func (m *MSSQLDatastore) SetQueryLimit(limit time.Duration) {
+	if m != nil {
+		m.queryLimit = limit
+	}
+}
+
 // Begin starts a single transaction. You MUST call Transaction.Rollback, or Transaction.Commit after calling Begin, or you WILL
 // leak memory.
 // It is safe to defer Transaction.Rollback immediately, even if you don't intend to rollback.
@@ -121,7 +132,7 @@ func (m *MSSQLDatastore) BeginTx(ctx context.Context) (Transaction, error) {
 		return nil, err
 	}
 
-	return &MSSQLTx{db: m.db, tx: tx}, nil
+	return &MSSQLTx{db: m.db, tx: tx, queryLimit: m.queryLimit}, nil
 }
 
 // Fetch provides a simple query-and-get operation. We will run your query and fill your container.
@@ -137,7 +148,7 @@ func (m *MSSQLDatastore) FetchWithMetrics(ctx context.Context, r metrics.Recorde
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -151,7 +162,9 @@ func (m *MSSQLDatastore) FetchWithMetrics(ctx context.Context, r metrics.Recorde
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::UnmarshalWithMetrics")
+	done := traceUnmarshal(ctx)
 	err = UnmarshalWithMetrics(r, rows, &container)
+	done(err)
 	end()
 	return err
 }
@@ -164,7 +177,7 @@ func (m *MSSQLDatastore) FetchJSON(ctx context.Context, query string, args ...in
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -175,7 +188,11 @@ func (m *MSSQLDatastore) FetchJSON(ctx context.Context, query string, args ...in
 
 	defer rows.Close()
 
-	return ToJSON(rows)
+	done := traceUnmarshal(ctx)
+	j, err := ToJSON(rows)
+	done(err)
+
+	return j, err
 }
 
 // FetchJSONWithMetrics provides a simple query-and-get operation. We will run your query and give you back the JSON representing your result set.
@@ -186,7 +203,7 @@ func (m *MSSQLDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.Rec
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -200,7 +217,9 @@ func (m *MSSQLDatastore) FetchJSONWithMetrics(ctx context.Context, r metrics.Rec
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::FetchJSONWithMetrics")
+	done := traceUnmarshal(ctx)
 	j, err := ToJSON(rows)
+	done(err)
 	end()
 
 	return j, err
@@ -215,7 +234,7 @@ func (m *MSSQLDatastore) Exec(ctx context.Context, query string, args ...interfa
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -231,7 +250,7 @@ func (m *MSSQLDatastore) ExecWithMetrics(ctx context.Context, r metrics.Recorder
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -246,6 +265,8 @@ func (m *MSSQLDatastore) ExecWithMetrics(ctx context.Context, r metrics.Recorder
 type MSSQLTx struct {
 	db *sql.DB
 	tx *sql.Tx
+
+	queryLimit time.Duration
 }
 
 // Ping sends a ping to the server and returns an error if it cannot connect.
@@ -260,7 +281,7 @@ func (m *MSSQLTx) Ping(ctx context.Context) error {
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -305,7 +326,7 @@ func (m *MSSQLTx) FetchWithMetrics(ctx context.Context, r metrics.Recorder, quer
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -323,7 +344,9 @@ func (m *MSSQLTx) FetchWithMetrics(ctx context.Context, r metrics.Recorder, quer
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::UnmarshalWithMetrics")
+	done := traceUnmarshal(ctx)
 	err = UnmarshalWithMetrics(r, rows, &container)
+	done(err)
 	end()
 	return err
 }
@@ -343,7 +366,7 @@ func (m *MSSQLTx) ExecWithMetrics(ctx context.Context, r metrics.Recorder, query
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -375,7 +398,7 @@ func (m *MSSQLTx) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder,
 
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, QueryLimit)
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout(ctx, m.queryLimit))
 		defer cancel()
 	}
 
@@ -389,7 +412,9 @@ func (m *MSSQLTx) FetchJSONWithMetrics(ctx context.Context, r metrics.Recorder,
 	defer rows.Close()
 
 	end = r.Segment("GODB::FetchWithMetrics::FetchJSONWithMetrics")
+	done := traceUnmarshal(ctx)
 	j, err := ToJSON(rows)
+	done(err)
 	end()
 
 	return j, err
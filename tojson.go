@@ -11,8 +11,8 @@ import (
 var hex = "0123456789abcdef"
 
 // ToJSON extracts a given SQL Rows result as json.
-func ToJSON(rows *sql.Rows) ([]byte, error) {
-	if rows == nil {
+func ToJSON(rows Rows) ([]byte, error) {
+	if isNilRows(rows) {
 		return nil, errors.New("empty result set")
 	}
 
@@ -1,14 +1,12 @@
 package godb
 
 import (
-	"database/sql"
-
 	"github.com/btm6084/gojson"
 	"github.com/btm6084/utilities/metrics"
 )
 
 // Unmarshal extracts a given SQL Rows result into a given container.
-func Unmarshal(rows *sql.Rows, v interface{}) error {
+func Unmarshal(rows Rows, v interface{}) error {
 	j, err := ToJSON(rows)
 	if err != nil {
 		return err
@@ -18,7 +16,7 @@ func Unmarshal(rows *sql.Rows, v interface{}) error {
 }
 
 // UnmarshalWithMetrics extracts a given SQL Rows result into a given container.
-func UnmarshalWithMetrics(r metrics.Recorder, rows *sql.Rows, v interface{}) error {
+func UnmarshalWithMetrics(r metrics.Recorder, rows Rows, v interface{}) error {
 	end := r.Segment("GODB::UnmarshalWithMetrics::ToJSON")
 	j, err := ToJSON(rows)
 	end()